@@ -0,0 +1,421 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type AniListMedia struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+	Chapters int    `json:"chapters"`
+	Volumes  int    `json:"volumes"`
+	Episodes int    `json:"episodes"`
+	SiteUrl  string `json:"siteUrl"`
+	Title    struct {
+		Romaji  string `json:"romaji"`
+		English string `json:"english"`
+	} `json:"title"`
+	Synonyms   []string `json:"synonyms"`
+	CoverImage struct {
+		Large string `json:"large"`
+	} `json:"coverImage"`
+	Description string   `json:"description"`
+	Genres      []string `json:"genres"`
+	StartDate   struct {
+		Year int `json:"year"`
+	} `json:"startDate"`
+	NextAiringEpisode *struct {
+		Episode  int   `json:"episode"`
+		AiringAt int64 `json:"airingAt"`
+	} `json:"nextAiringEpisode"`
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
+type AniListEntry struct {
+	Status    string       `json:"status"`
+	Progress  int          `json:"progress"`
+	Score     float32      `json:"score"`
+	UpdatedAt int64        `json:"updatedAt"`
+	Media     AniListMedia `json:"media"`
+}
+
+type AniListListResponse struct {
+	Data struct {
+		MediaListCollection struct {
+			Lists []struct {
+				Entries []AniListEntry `json:"entries"`
+			} `json:"lists"`
+		} `json:"MediaListCollection"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+		Status  int    `json:"status"`
+	} `json:"errors,omitempty"`
+}
+
+const aniListMediaFields = `
+	id type status chapters volumes episodes siteUrl updatedAt
+	title { romaji english }
+	synonyms
+	coverImage { large }
+	description(asHtml: false)
+	genres
+	startDate { year }
+	nextAiringEpisode { episode airingAt }
+`
+
+const aniListListQuery = `query ($userName: String, $type: MediaType) {
+	MediaListCollection(userName: $userName, type: $type) {
+		lists {
+			entries {
+				status progress score(format: POINT_10_DECIMAL) updatedAt
+				media {` + aniListMediaFields + `}
+			}
+		}
+	}
+}`
+
+const aniListScheduleQuery = `query ($id: Int, $search: String) {
+	Media(id: $id, search: $search, type: ANIME) {
+		id status episodes
+		title { romaji english }
+		synonyms
+		nextAiringEpisode { episode airingAt }
+		airingSchedule(notYetAired: true, perPage: 25) {
+			nodes { episode airingAt }
+		}
+	}
+}`
+
+type AniListScheduleResponse struct {
+	Data struct {
+		Media *struct {
+			ID       int    `json:"id"`
+			Status   string `json:"status"`
+			Episodes int    `json:"episodes"`
+			Title    struct {
+				Romaji  string `json:"romaji"`
+				English string `json:"english"`
+			} `json:"title"`
+			Synonyms          []string `json:"synonyms"`
+			NextAiringEpisode *struct {
+				Episode  int   `json:"episode"`
+				AiringAt int64 `json:"airingAt"`
+			} `json:"nextAiringEpisode"`
+			AiringSchedule struct {
+				Nodes []struct {
+					Episode  int   `json:"episode"`
+					AiringAt int64 `json:"airingAt"`
+				} `json:"nodes"`
+			} `json:"airingSchedule"`
+		} `json:"Media"`
+	} `json:"data"`
+}
+
+type aniListIntegration struct {
+	userName string
+	token    string
+}
+
+func (aniListIntegration) Name() string {
+	return "AniList"
+}
+
+func (aniListIntegration) LinkDomain() string {
+	return "anilist.co"
+}
+
+func (a aniListIntegration) Enabled() bool {
+	return a.userName != ""
+}
+
+func (a aniListIntegration) Fetch(ctx context.Context) []Manga {
+	var mangas []Manga
+
+	for _, mediaType := range []string{"MANGA", "ANIME"} {
+		var listResponse AniListListResponse
+
+		if !a.query(ctx, aniListListQuery, map[string]interface{}{"userName": a.userName, "type": mediaType}, &listResponse) {
+			continue
+		}
+
+		for _, list := range listResponse.Data.MediaListCollection.Lists {
+			for _, entry := range list.Entries {
+				mangas = append(mangas, aniListEntryToManga(entry))
+			}
+		}
+	}
+
+	return mangas
+}
+
+// query runs a GraphQL query against AniList and decodes the response into
+// response. It waits out AniList's rate limit when it is hit.
+func (a aniListIntegration) query(ctx context.Context, query string, variables map[string]interface{}, response interface{}) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	})
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://graphql.anilist.co", bytes.NewBuffer(body))
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	if a.token != "" {
+		req.Header.Add("Authorization", "Bearer "+a.token)
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		slog.Error("Error querying anilist", "source", "anilist", "err", err)
+
+		return false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 429 {
+		slog.Warn("Too many requests to anilist, sleeping for 1 minute", "source", "anilist")
+		if !sleep(ctx, time.Minute) {
+			return false
+		}
+
+		return a.query(ctx, query, variables, response)
+	}
+
+	if res.StatusCode != 200 {
+		slog.Error("Error querying anilist", "source", "anilist", "status_code", res.StatusCode)
+
+		return false
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		slog.Error("Error parsing response body for anilist", "source", "anilist", "err", err)
+
+		return false
+	}
+
+	return true
+}
+
+// aniListScheduleSource reads the airing schedule of an anime from AniList. Pages
+// are matched to AniList by title and the match is remembered in the sync state.
+type aniListScheduleSource struct {
+	client aniListIntegration
+}
+
+func (aniListScheduleSource) Name() string {
+	return "anilist"
+}
+
+func (aniListScheduleSource) Matches(manga Manga) bool {
+	return manga.Title != ""
+}
+
+func (a aniListScheduleSource) Fetch(ctx context.Context, manga Manga) (AiringStatus, bool) {
+	var airingStatus AiringStatus
+
+	pageState := getPageState(manga.ID)
+	variables := map[string]interface{}{}
+
+	id := aniListID(manga)
+	if id != 0 {
+		variables["id"] = id
+	} else {
+		variables["search"] = manga.Title
+	}
+
+	var scheduleResponse AniListScheduleResponse
+
+	if !a.client.query(ctx, aniListScheduleQuery, variables, &scheduleResponse) || scheduleResponse.Data.Media == nil {
+		return airingStatus, false
+	}
+
+	media := scheduleResponse.Data.Media
+
+	if id == 0 {
+		// The search is fuzzy, only a hit with the same title is remembered
+		titles := append([]string{media.Title.Romaji, media.Title.English}, media.Synonyms...)
+		matched := false
+
+		for _, title := range titles {
+			if strings.EqualFold(title, manga.Title) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			slog.Warn("No anilist match for anime", "page_id", manga.ID, "source", "anilist", "title", manga.Title, "match", media.Title.Romaji)
+
+			return airingStatus, false
+		}
+
+		slog.Info("Matched anime to anilist", "page_id", manga.ID, "source", "anilist", "title", manga.Title, "match", media.Title.Romaji)
+
+		pageState.AniListID = media.ID
+		setPageState(manga.ID, pageState)
+	}
+
+	airingStatus.Episodes = media.Episodes
+	airingStatus.Finished = media.Status == "FINISHED"
+
+	if media.NextAiringEpisode != nil {
+		airingStatus.LatestEpisode = media.NextAiringEpisode.Episode - 1
+	} else if airingStatus.Finished {
+		airingStatus.LatestEpisode = media.Episodes
+	}
+
+	for _, node := range media.AiringSchedule.Nodes {
+		airingStatus.Upcoming = append(airingStatus.Upcoming, Airing{
+			Episode:  node.Episode,
+			AiringAt: time.Unix(node.AiringAt, 0),
+		})
+	}
+
+	return airingStatus, true
+}
+
+var aniListAnimeLink = regexp.MustCompile(`anilist\.co/anime/([0-9]+)`)
+
+// aniListID returns the AniList ID of an anime page, as matched before or as
+// found in its link, or 0 when it is not known.
+func aniListID(manga Manga) int {
+	if id := getPageState(manga.ID).AniListID; id != 0 {
+		return id
+	}
+
+	if matches := aniListAnimeLink.FindStringSubmatch(manga.Link); matches != nil {
+		id, _ := strconv.Atoi(matches[1])
+		return id
+	}
+
+	return 0
+}
+
+func newAniListScheduleSource() aniListScheduleSource {
+	return aniListScheduleSource{
+		client: aniListIntegration{
+			token: getenv("ANILIST_TOKEN"),
+		},
+	}
+}
+
+func aniListEntryToManga(entry AniListEntry) Manga {
+	media := entry.Media
+
+	manga := Manga{
+		Type:              "Manga",
+		Title:             media.Title.English,
+		Link:              media.SiteUrl,
+		CurrentProgress:   float32(entry.Progress),
+		Rating:            entry.Score,
+		SeenLatestRelease: false,
+		Art:               media.CoverImage.Large,
+		Description:       media.Description,
+		Genres:            media.Genres,
+		AltTitles:         media.Synonyms,
+		PublicationStatus: aniListPublicationStatus(media.Status),
+		Year:              media.StartDate.Year,
+	}
+
+	if manga.Title == "" {
+		manga.Title = media.Title.Romaji
+	} else if media.Title.Romaji != "" {
+		manga.AltTitles = append([]string{media.Title.Romaji}, manga.AltTitles...)
+	}
+
+	if manga.Link == "" {
+		manga.Link = fmt.Sprintf("https://anilist.co/%s/%v", strings.ToLower(media.Type), media.ID)
+	}
+
+	updatedAt := media.UpdatedAt
+	if entry.UpdatedAt > updatedAt {
+		updatedAt = entry.UpdatedAt
+	}
+	manga.LatestReleaseUpdatedAt = time.Unix(updatedAt, 0).In(loc).Format("2006-01-02 15:04:05")
+
+	if media.Type == "ANIME" {
+		manga.Type = "Anime"
+
+		if media.NextAiringEpisode != nil {
+			manga.LatestRelease = float32(media.NextAiringEpisode.Episode - 1)
+		} else {
+			manga.LatestRelease = float32(media.Episodes)
+		}
+
+		manga.LastChapter = float32(media.Episodes)
+	} else {
+		manga.LatestRelease = float32(media.Chapters)
+		manga.LastChapter = float32(media.Chapters)
+
+		if media.Volumes != 0 {
+			manga.LastVolume = fmt.Sprintf("%v", media.Volumes)
+		}
+	}
+
+	manga.Status = []string{aniListStatus(entry.Status, manga.Type == "Anime")}
+
+	return manga
+}
+
+func aniListStatus(status string, anime bool) string {
+	switch status {
+	case "CURRENT", "REPEATING":
+		if anime {
+			return Watching
+		}
+
+		return Reading
+	case "PLANNING":
+		if anime {
+			return PlanningToWatch
+		}
+
+		return PlanningToRead
+	case "COMPLETED":
+		return Completed
+	case "DROPPED":
+		return Dropped
+	case "PAUSED":
+		return OnHold
+	default:
+		if anime {
+			return PlanningToWatch
+		}
+
+		return PlanningToRead
+	}
+}
+
+func aniListPublicationStatus(status string) string {
+	switch status {
+	case "FINISHED":
+		return "Completed"
+	case "RELEASING":
+		return "Ongoing"
+	case "HIATUS":
+		return "Hiatus"
+	case "CANCELLED":
+		return "Cancelled"
+	case "NOT_YET_RELEASED":
+		return "Not Yet Released"
+	default:
+		return ""
+	}
+}
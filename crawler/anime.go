@@ -0,0 +1,237 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Airing is a single episode airing of an anime.
+type Airing struct {
+	Episode  int       `json:"episode"`
+	AiringAt time.Time `json:"airingAt"`
+}
+
+// AiringStatus describes how far an anime has aired.
+type AiringStatus struct {
+	LatestEpisode int
+	LatestAiredAt time.Time
+	Episodes      int
+	Finished      bool
+	Upcoming      []Airing
+}
+
+// AnimeSource reads the airing schedule of the anime a Notion page tracks.
+type AnimeSource interface {
+	Name() string
+	Matches(manga Manga) bool
+	Fetch(ctx context.Context, manga Manga) (AiringStatus, bool)
+}
+
+// animeSources returns the anime sources in order of preference. The local
+// schedule comes first so it can override the schedule AniList knows about.
+func animeSources() []AnimeSource {
+	return []AnimeSource{
+		newLocalScheduleSource(),
+		newAniListScheduleSource(),
+	}
+}
+
+func isAnime(manga Manga) bool {
+	return manga.Type == "Anime" || strings.Contains(manga.Link, "pahe.win") || strings.Contains(manga.Link, "animepahe.com")
+}
+
+// syncAnimeEpisodes bumps the latest release of an anime page to the latest aired
+// episode and moves it to Done Airing once the final episode has aired.
+func syncAnimeEpisodes(ctx context.Context, manga Manga, sources []AnimeSource) {
+	var airing AiringStatus
+	found := false
+
+	for _, source := range sources {
+		if source.Matches(manga) {
+			if airing, found = source.Fetch(ctx, manga); found {
+				break
+			}
+		}
+	}
+
+	if !found {
+		recordScrapeFailure(ScrapeFailure{
+			Link:   manga.Link,
+			Source: "anime",
+			Reason: "no airing schedule found",
+			At:     time.Now(),
+		})
+
+		return
+	}
+
+	recordSourceSuccess("anime")
+	recordAirings(manga.ID, airing.Upcoming)
+
+	episodes := airing.Episodes
+	if episodes == 0 && manga.LastChapter != 0 {
+		episodes = int(manga.LastChapter)
+	}
+
+	latestEpisode := airing.LatestEpisode
+	if episodes != 0 && latestEpisode > episodes {
+		latestEpisode = episodes
+	}
+
+	status := ""
+	if (airing.Finished || (episodes != 0 && latestEpisode >= episodes)) && !contains(manga.Status, DoneAiring) {
+		status = DoneAiring
+	}
+
+	if float32(latestEpisode) > manga.LatestRelease {
+		airedAt := ""
+		if !airing.LatestAiredAt.IsZero() {
+			airedAt = airing.LatestAiredAt.In(loc).Format("2006-01-02 15:04:05")
+		}
+
+		recordNewRelease("anime")
+		goWrite(func() { releaseChapter(ctx, manga, float32(latestEpisode), airedAt, status) })
+	} else if status != "" {
+		slog.Info("Marking anime as done airing", "page_id", manga.ID, "url", manga.Link)
+
+		goWrite(func() { updateStatus(ctx, manga.ID, status) })
+	}
+}
+
+// recordListAirings records the upcoming episodes of an anime page kept up to date
+// by a list integration, so the calendar has them as well. Only pages known to
+// AniList are looked up.
+func recordListAirings(ctx context.Context, manga Manga) {
+	if !isAnime(manga) || aniListID(manga) == 0 {
+		return
+	}
+
+	if airing, found := newAniListScheduleSource().Fetch(ctx, manga); found {
+		recordAirings(manga.ID, airing.Upcoming)
+	}
+}
+
+// ScheduleEntry is an anime in the local schedule file. Episodes air at the times
+// listed in Airing, or every IntervalDays starting at Start.
+type ScheduleEntry struct {
+	Title        string      `json:"title"`
+	Link         string      `json:"link"`
+	Episodes     int         `json:"episodes"`
+	Start        time.Time   `json:"start"`
+	IntervalDays int         `json:"intervalDays"`
+	Airing       []time.Time `json:"airing"`
+}
+
+// localScheduleSource reads airing times from the JSON file at ANIME_SCHEDULE_FILE,
+// for anime that aren't on AniList or whose schedule is off.
+type localScheduleSource struct {
+	entries []ScheduleEntry
+}
+
+func (localScheduleSource) Name() string {
+	return "schedule"
+}
+
+func (l localScheduleSource) Matches(manga Manga) bool {
+	_, ok := l.entry(manga)
+
+	return ok
+}
+
+func (l localScheduleSource) Fetch(ctx context.Context, manga Manga) (AiringStatus, bool) {
+	entry, ok := l.entry(manga)
+
+	if !ok {
+		return AiringStatus{}, false
+	}
+
+	airingStatus := AiringStatus{
+		Episodes: entry.Episodes,
+	}
+	now := time.Now()
+
+	for i, airingAt := range entry.airingTimes() {
+		if airingAt.After(now) {
+			airingStatus.Upcoming = append(airingStatus.Upcoming, Airing{Episode: i + 1, AiringAt: airingAt})
+			continue
+		}
+
+		airingStatus.LatestEpisode = i + 1
+		airingStatus.LatestAiredAt = airingAt
+	}
+
+	airingStatus.Finished = entry.Episodes != 0 && airingStatus.LatestEpisode >= entry.Episodes
+
+	return airingStatus, true
+}
+
+func (l localScheduleSource) entry(manga Manga) (ScheduleEntry, bool) {
+	for _, entry := range l.entries {
+		if (entry.Link != "" && entry.Link == manga.Link) || (entry.Title != "" && strings.EqualFold(entry.Title, manga.Title)) {
+			return entry, true
+		}
+	}
+
+	return ScheduleEntry{}, false
+}
+
+// airingTimes returns the airing time of every episode. Schedules without an
+// episode count are generated until four weeks from now.
+func (s ScheduleEntry) airingTimes() []time.Time {
+	if len(s.Airing) > 0 {
+		if s.Episodes != 0 && len(s.Airing) > s.Episodes {
+			return s.Airing[:s.Episodes]
+		}
+
+		return s.Airing
+	}
+
+	if s.Start.IsZero() {
+		return nil
+	}
+
+	interval := s.IntervalDays
+	if interval <= 0 {
+		interval = 7
+	}
+
+	var times []time.Time
+	until := time.Now().AddDate(0, 0, 28)
+
+	for airingAt := s.Start; s.Episodes == 0 || len(times) < s.Episodes; airingAt = airingAt.AddDate(0, 0, interval) {
+		if s.Episodes == 0 && airingAt.After(until) {
+			break
+		}
+
+		times = append(times, airingAt)
+	}
+
+	return times
+}
+
+func newLocalScheduleSource() localScheduleSource {
+	var source localScheduleSource
+
+	path := getenv("ANIME_SCHEDULE_FILE")
+	if path == "" {
+		return source
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		slog.Error("Error reading anime schedule", "path", path, "err", err)
+
+		return source
+	}
+
+	if err := json.Unmarshal(data, &source.entries); err != nil {
+		slog.Error("Error parsing anime schedule", "path", path, "err", err)
+	}
+
+	return source
+}
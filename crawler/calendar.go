@@ -0,0 +1,260 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// calendarEvent is a VEVENT in the calendar feed. All day events only use the date
+// of Start.
+type calendarEvent struct {
+	UID      string
+	Summary  string
+	URL      string
+	Start    time.Time
+	AllDay   bool
+	Duration time.Duration
+	RRule    string
+}
+
+var weekdays = map[string]string{
+	"Monday":    "MO",
+	"Tuesday":   "TU",
+	"Wednesday": "WE",
+	"Thursday":  "TH",
+	"Friday":    "FR",
+	"Saturday":  "SA",
+	"Sunday":    "SU",
+}
+
+// WriteCalendar writes an iCalendar feed of the upcoming releases of all tracked
+// series. Anime use their airing schedule, manga their Release Schedule weekday
+// or, failing that, the cadence of their release history.
+func WriteCalendar(ctx context.Context, w io.Writer) error {
+	loadConfig()
+	detectSchemaTypes(ctx)
+
+	mangas, ok := getAllNotionPages(ctx)
+	if !ok {
+		return errNotionQuery
+	}
+
+	return writeCalendar(w, calendarEvents(mangas))
+}
+
+// writeCalendarFile writes the calendar feed to CALENDAR_FILE when it is set.
+func writeCalendarFile(ctx context.Context) {
+	path := getenv("CALENDAR_FILE")
+	if path == "" {
+		return
+	}
+
+	// The previous calendar is kept when the database cannot be read
+	mangas, ok := getAllNotionPages(ctx)
+	if !ok {
+		return
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		slog.Error("Error creating calendar file", "path", path, "err", err)
+
+		return
+	}
+	defer file.Close()
+
+	if err := writeCalendar(file, calendarEvents(mangas)); err != nil {
+		slog.Error("Error writing calendar file", "path", path, "err", err)
+	}
+}
+
+// calendarEvents builds the events of the active series. Anime episodes come
+// from the airings recorded by the last sync.
+func calendarEvents(mangas []Manga) []calendarEvent {
+	var events []calendarEvent
+
+	stateMutex.Lock()
+	releases := state.Releases
+	airings := state.Airings
+	stateMutex.Unlock()
+
+	for _, manga := range mangas {
+		if !isActive(manga) || contains(manga.Status, DoneAiring) {
+			continue
+		}
+
+		if isAnime(manga) {
+			if airingEvents := animeCalendarEvents(manga, airings[manga.ID]); len(airingEvents) > 0 {
+				events = append(events, airingEvents...)
+				continue
+			}
+		}
+
+		if day, ok := weekdays[manga.ReleaseSchedule]; ok {
+			events = append(events, calendarEvent{
+				UID:     manga.ID + "-schedule",
+				Summary: manga.Title,
+				URL:     manga.Link,
+				Start:   nextWeekday(manga.ReleaseSchedule),
+				AllDay:  true,
+				RRule:   "FREQ=WEEKLY;BYDAY=" + day,
+			})
+
+			continue
+		}
+
+		if next, interval, ok := estimateCadence(releases[manga.ID]); ok {
+			events = append(events, calendarEvent{
+				UID:     manga.ID + "-estimated",
+				Summary: manga.Title + " (estimated)",
+				URL:     manga.Link,
+				Start:   next,
+				AllDay:  true,
+				RRule:   fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", interval),
+			})
+		}
+	}
+
+	return events
+}
+
+func animeCalendarEvents(manga Manga, airings []Airing) []calendarEvent {
+	var events []calendarEvent
+	now := time.Now()
+
+	for _, upcoming := range airings {
+		// Episodes that aired since the last sync are left out
+		if upcoming.AiringAt.Before(now) {
+			continue
+		}
+
+		events = append(events, calendarEvent{
+			UID:      fmt.Sprintf("%s-episode-%d", manga.ID, upcoming.Episode),
+			Summary:  fmt.Sprintf("%s episode %d", manga.Title, upcoming.Episode),
+			URL:      manga.Link,
+			Start:    upcoming.AiringAt,
+			Duration: 30 * time.Minute,
+		})
+	}
+
+	return events
+}
+
+// nextWeekday returns the next date, today included, that falls on day.
+func nextWeekday(day string) time.Time {
+	date := time.Now().In(loc)
+
+	for date.Weekday().String() != day {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return date
+}
+
+// estimateCadence estimates the release interval in days of a series from the
+// median gap in its release history, and the next release date from it. At least
+// three releases are needed for an estimate.
+func estimateCadence(releases []Release) (time.Time, int, bool) {
+	if len(releases) < 3 {
+		return time.Time{}, 0, false
+	}
+
+	releases = append([]Release(nil), releases...)
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].At.Before(releases[j].At)
+	})
+
+	var gaps []float64
+	for i := 1; i < len(releases); i++ {
+		gaps = append(gaps, releases[i].At.Sub(releases[i-1].At).Hours()/24)
+	}
+	sort.Float64s(gaps)
+
+	interval := int(gaps[len(gaps)/2] + 0.5)
+	if interval < 1 {
+		interval = 1
+	}
+
+	next := releases[len(releases)-1].At.In(loc).AddDate(0, 0, interval)
+	year, month, day := time.Now().In(loc).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	for next.Before(today) {
+		next = next.AddDate(0, 0, interval)
+	}
+
+	return next, interval, true
+}
+
+func writeCalendar(w io.Writer, events []calendarEvent) error {
+	writer := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	writeCalendarLine(writer, "BEGIN:VCALENDAR")
+	writeCalendarLine(writer, "VERSION:2.0")
+	writeCalendarLine(writer, "PRODID:-//go-notion-manga-tracker//EN")
+	writeCalendarLine(writer, "CALSCALE:GREGORIAN")
+	writeCalendarLine(writer, "X-WR-CALNAME:Manga releases")
+
+	for _, event := range events {
+		writeCalendarLine(writer, "BEGIN:VEVENT")
+		writeCalendarLine(writer, "UID:"+event.UID+"@go-notion-manga-tracker")
+		writeCalendarLine(writer, "DTSTAMP:"+stamp)
+
+		if event.AllDay {
+			writeCalendarLine(writer, "DTSTART;VALUE=DATE:"+event.Start.Format("20060102"))
+		} else {
+			writeCalendarLine(writer, "DTSTART:"+event.Start.UTC().Format("20060102T150405Z"))
+			writeCalendarLine(writer, fmt.Sprintf("DURATION:PT%dM", int(event.Duration.Minutes())))
+		}
+
+		if event.RRule != "" {
+			writeCalendarLine(writer, "RRULE:"+event.RRule)
+		}
+
+		writeCalendarLine(writer, "SUMMARY:"+escapeCalendarText(event.Summary))
+
+		if event.URL != "" {
+			writeCalendarLine(writer, "URL:"+event.URL)
+		}
+
+		writeCalendarLine(writer, "END:VEVENT")
+	}
+
+	writeCalendarLine(writer, "END:VCALENDAR")
+
+	return writer.Flush()
+}
+
+// writeCalendarLine writes a content line, folding it at 75 octets as required by
+// RFC 5545 without splitting multi-byte characters.
+func writeCalendarLine(w *bufio.Writer, line string) {
+	limit := 75
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && (line[cut]&0xC0) == 0x80 {
+			cut--
+		}
+
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+
+		// Continuation lines start with a space
+		limit = 74
+	}
+
+	w.WriteString(line + "\r\n")
+}
+
+func escapeCalendarText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(text)
+}
@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+const defaultUserAgent = "Mozilla/5.0 (compatible; go-notion-manga-tracker; +https://github.com/florisboom/go-notion-manga-tracker)"
+
+var scraperUserAgent = defaultUserAgent
+var scraperTimeout = time.Second * 30
+var scraperRetries = 3
+var scraperBackoff = time.Second * 2
+var scraperRespectRobots bool
+var scraperLimits []*colly.LimitRule
+var scraperCookies http.CookieJar
+
+// loadScraperConfig reads the configuration shared by all scrapers:
+//
+//   - SCRAPER_USER_AGENT, the user agent sent to the scraped sites
+//   - SCRAPER_TIMEOUT, the timeout of a single attempt of a request (default 30s)
+//   - SCRAPER_RETRIES, how often a request failing with a 5xx or 429 status is
+//     retried (default 3), with a backoff starting at SCRAPER_BACKOFF (default 2s)
+//   - SCRAPER_DELAY, SCRAPER_RANDOM_DELAY and SCRAPER_PARALLELISM, the limits
+//     for every domain (default 1s and 1 request at a time)
+//   - SCRAPER_DOMAIN_DELAYS, delays for single domains, such as
+//     "mangabuddy.com=5s,toomics.com=2s"
+//   - SCRAPER_RESPECT_ROBOTS, whether robots.txt is obeyed
+//
+// The scrapers are shared by all profiles, so they are configured from the
+// environment only.
+func loadScraperConfig() {
+	if userAgent := os.Getenv("SCRAPER_USER_AGENT"); userAgent != "" {
+		scraperUserAgent = userAgent
+	}
+
+	scraperTimeout = durationEnv("SCRAPER_TIMEOUT", scraperTimeout)
+	scraperBackoff = durationEnv("SCRAPER_BACKOFF", scraperBackoff)
+
+	if retries := os.Getenv("SCRAPER_RETRIES"); retries != "" {
+		if n, err := strconv.Atoi(retries); err == nil && n >= 0 {
+			scraperRetries = n
+		} else {
+			slog.Error("Error parsing SCRAPER_RETRIES", "value", retries)
+		}
+	}
+
+	scraperRespectRobots, _ = strconv.ParseBool(os.Getenv("SCRAPER_RESPECT_ROBOTS"))
+
+	parallelism := 1
+	if value := os.Getenv("SCRAPER_PARALLELISM"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			parallelism = n
+		} else {
+			slog.Error("Error parsing SCRAPER_PARALLELISM", "value", value)
+		}
+	}
+
+	delay := durationEnv("SCRAPER_DELAY", time.Second)
+	randomDelay := durationEnv("SCRAPER_RANDOM_DELAY", 0)
+
+	// colly applies the first matching rule, so the domain rules come first
+	scraperLimits = nil
+
+	for _, domainDelay := range strings.Split(os.Getenv("SCRAPER_DOMAIN_DELAYS"), ",") {
+		domain, value, found := strings.Cut(strings.TrimSpace(domainDelay), "=")
+		if !found {
+			continue
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			slog.Error("Error parsing SCRAPER_DOMAIN_DELAYS", "domain", domain, "err", err)
+			continue
+		}
+
+		scraperLimits = append(scraperLimits, &colly.LimitRule{
+			DomainGlob:  "*" + strings.TrimSpace(domain),
+			Delay:       d,
+			RandomDelay: randomDelay,
+			Parallelism: parallelism,
+		})
+	}
+
+	scraperLimits = append(scraperLimits, &colly.LimitRule{
+		DomainGlob:  "*",
+		Delay:       delay,
+		RandomDelay: randomDelay,
+		Parallelism: parallelism,
+	})
+
+	scraperCookies, _ = cookiejar.New(nil)
+}
+
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Error("Error parsing "+key, "err", err)
+		return fallback
+	}
+
+	return d
+}
+
+var baseCollector *colly.Collector
+var baseCollectorOnce sync.Once
+
+// newCollector returns a collector with the shared scraper configuration and a
+// function to call once it is done. Its requests are cancelled when ctx is done.
+//
+// The collectors are clones of one base collector, so they share its HTTP client,
+// limits and cookies. Sites that set a session or consent cookie only do so once,
+// and the limits hold across all scrapes.
+func newCollector(ctx context.Context) (*colly.Collector, func()) {
+	baseCollectorOnce.Do(func() {
+		baseCollector = colly.NewCollector(colly.UserAgent(scraperUserAgent))
+		baseCollector.IgnoreRobotsTxt = !scraperRespectRobots
+		baseCollector.WithTransport(scrapeContextTransport{next: retryTransport{next: scrapeTransport}})
+		// retryTransport applies SCRAPER_TIMEOUT to every attempt, a client timeout
+		// would also count the waits between them
+		baseCollector.SetRequestTimeout(0)
+
+		if scraperCookies != nil {
+			baseCollector.SetCookieJar(scraperCookies)
+		}
+
+		if err := baseCollector.Limits(scraperLimits); err != nil {
+			slog.Error("Error setting scraper limits", "err", err)
+		}
+	})
+
+	c := baseCollector.Clone()
+
+	// The clones share one transport, the header tells it which context a
+	// request belongs to
+	id := strconv.FormatUint(scrapeContextID.Add(1), 10)
+	scrapeContexts.Store(id, ctx)
+
+	c.OnRequest(func(r *colly.Request) {
+		r.Headers.Set(scrapeContextHeader, id)
+	})
+
+	return c, func() { scrapeContexts.Delete(id) }
+}
+
+const scrapeContextHeader = "X-Scrape-Context"
+
+var scrapeContexts sync.Map
+var scrapeContextID atomic.Uint64
+
+// scrapeContextTransport attaches the context of the collector a request was made
+// by, see newCollector.
+type scrapeContextTransport struct {
+	next http.RoundTripper
+}
+
+func (t scrapeContextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := req.Header.Get(scrapeContextHeader)
+	if id == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	if value, ok := scrapeContexts.Load(id); ok {
+		ctx = value.(context.Context)
+	}
+
+	req = req.Clone(ctx)
+	req.Header.Del(scrapeContextHeader)
+
+	return t.next.RoundTrip(req)
+}
+
+// retryTransport retries requests that fail with a 5xx or 429 status, waiting
+// for the Retry-After header or an exponential backoff in between. Every attempt
+// has SCRAPER_TIMEOUT to complete, including reading the body.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := scraperBackoff
+
+	for attempt := 1; ; attempt++ {
+		var ctx context.Context
+		var cancel context.CancelFunc
+
+		if scraperTimeout > 0 {
+			ctx, cancel = context.WithTimeout(req.Context(), scraperTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(req.Context())
+		}
+
+		res, err := t.next.RoundTrip(req.WithContext(ctx))
+
+		if err != nil {
+			cancel()
+			return res, err
+		}
+
+		if attempt > scraperRetries || !isRetryable(res.StatusCode) {
+			res.Body = cancelBody{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+
+		wait := retryAfter(res, backoff)
+		closeResponse(res)
+		cancel()
+
+		slog.Warn("Retrying request", "source", sourceName(req.URL.String()), "url", req.URL.String(), "status_code", res.StatusCode, "attempt", attempt, "wait", wait.String())
+
+		if !sleep(req.Context(), wait) {
+			return nil, req.Context().Err()
+		}
+
+		backoff *= 2
+	}
+}
+
+// cancelBody releases the context of an attempt once its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
+
+func isRetryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// retryAfter returns the wait requested by the Retry-After header of res, up to
+// a minute, or backoff when it has none.
+func retryAfter(res *http.Response, backoff time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return backoff
+	}
+
+	if wait := time.Duration(seconds) * time.Second; wait < time.Minute {
+		return wait
+	}
+
+	return time.Minute
+}
@@ -1,20 +1,82 @@
 package crawler
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gocolly/colly/v2"
 )
 
-func CrawlManga(url string, latestRelease float32) float32 {
-	log.Printf("Syncing %s", url)
+type ScrapedSeries struct {
+	Title              string
+	AltTitles          []string
+	Authors            []string
+	Status             string
+	Cover              string
+	LatestChapter      float32
+	LatestReleaseDate  string
+	LatestReleaseGroup string
+	Source             string
+}
+
+// scrapedSites are the sites scrapeSeries knows how to read.
+var scrapedSites = []string{
+	"mangakakalot.com",
+	"mangakakalot.to",
+	"manganato.com",
+	"mangabuddy.com",
+	"mangaweeaboo.com",
+	"toomics.com",
+}
+
+func isScrapedSite(link string) bool {
+	for _, site := range scrapedSites {
+		if strings.Contains(link, site) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func CrawlManga(ctx context.Context, url string, latestRelease float32) float32 {
+	series := scrapeSeries(ctx, url)
 
-	c := colly.NewCollector()
+	if series.LatestChapter == 0 {
+		return latestRelease
+	}
+
+	return series.LatestChapter
+}
+
+func scrapeSeries(ctx context.Context, url string) ScrapedSeries {
+	slog.Info("Scraping series", "source", sourceName(url), "url", url)
+
+	c, done := newCollector(ctx)
+	defer done()
+
+	var series ScrapedSeries
 	var latestChapter string
+	var ogImage string
 	re := regexp.MustCompile(`[0-9]+`)
+	seriesURL := url
+
+	supported := true
+	var visitErr error
+
+	c.OnHTML("meta[property='og:image']", func(e *colly.HTMLElement) {
+		ogImage = absoluteURL(e, e.Attr("content"))
+	})
+	c.OnError(func(res *colly.Response, err error) {
+		visitErr = fmt.Errorf("%s, status code: %v", err, res.StatusCode)
+	})
 
 	switch true {
 	case strings.Contains(url, "mangakakalot.com"):
@@ -22,6 +84,19 @@ func CrawlManga(url string, latestRelease float32) float32 {
 			latestChapter = e.ChildText("div:first-child span:first-child a")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".manga-info-top", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText(".manga-info-text li:first-child h1")
+			series.AltTitles = splitList(strings.TrimPrefix(e.ChildText(".story-alternative"), "Alternative :"))
+			series.Cover = absoluteURL(e, e.ChildAttr(".manga-info-pic img", "src"))
+			e.ForEach(".manga-info-text li", func(_ int, li *colly.HTMLElement) {
+				switch {
+				case strings.HasPrefix(li.Text, "Author"):
+					series.Authors = li.ChildTexts("a")
+				case strings.HasPrefix(li.Text, "Status"):
+					series.Status = normalizeStatus(li.Text)
+				}
+			})
+		})
 		break
 	case strings.Contains(url, "mangakakalot.to"):
 		mangaID := re.FindString(url)
@@ -31,45 +106,215 @@ func CrawlManga(url string, latestRelease float32) float32 {
 			latestChapter = e.ChildText("div:first-child div:first-child a")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".manga-detail", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText(".manga-name")
+			series.AltTitles = splitList(e.ChildText(".manga-name-or"))
+			series.Cover = absoluteURL(e, e.ChildAttr(".manga-poster img", "src"))
+			e.ForEach(".anisc-info .item", func(_ int, item *colly.HTMLElement) {
+				switch {
+				case strings.HasPrefix(item.ChildText(".item-head"), "Author"):
+					series.Authors = item.ChildTexts("a")
+				case strings.HasPrefix(item.ChildText(".item-head"), "Status"):
+					series.Status = normalizeStatus(item.ChildText(".name"))
+				}
+			})
+		})
 		break
 	case strings.Contains(url, "readmanganato.com") || strings.Contains(url, "manganato.com"):
 		c.OnHTML(".row-content-chapter", func(e *colly.HTMLElement) {
 			latestChapter = e.ChildText("li:first-child a")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".panel-story-info", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText(".story-info-right h1")
+			series.Cover = absoluteURL(e, e.ChildAttr(".info-image img", "src"))
+			e.ForEach(".variations-tableInfo tr", func(_ int, tr *colly.HTMLElement) {
+				switch {
+				case strings.HasPrefix(tr.ChildText(".table-label"), "Alternative"):
+					series.AltTitles = splitList(tr.ChildText(".table-value"))
+				case strings.HasPrefix(tr.ChildText(".table-label"), "Author"):
+					series.Authors = tr.ChildTexts(".table-value a")
+				case strings.HasPrefix(tr.ChildText(".table-label"), "Status"):
+					series.Status = normalizeStatus(tr.ChildText(".table-value"))
+				}
+			})
+		})
 		break
 	case strings.Contains(url, "mangabuddy.com"):
 		c.OnHTML("#chapter-list", func(e *colly.HTMLElement) {
 			latestChapter = e.ChildText("li:first-child a:first-child div:first-child strong")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".book-info", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText(".name h1")
+			series.AltTitles = splitList(e.ChildText(".name h2"))
+			series.Cover = absoluteURL(e, e.ChildAttr(".img-cover img", "data-src"))
+			e.ForEach(".meta p", func(_ int, p *colly.HTMLElement) {
+				switch {
+				case strings.HasPrefix(p.ChildText("strong"), "Authors"):
+					series.Authors = p.ChildTexts("a")
+				case strings.HasPrefix(p.ChildText("strong"), "Status"):
+					series.Status = normalizeStatus(p.ChildText("a"))
+				}
+			})
+		})
 		break
 	case strings.Contains(url, "mangaweeaboo.com"):
 		c.OnHTML(".version-chap", func(e *colly.HTMLElement) {
 			latestChapter = e.ChildText("li:first-child a")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".profile-manga", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText(".post-title h1")
+			series.Cover = absoluteURL(e, e.ChildAttr(".summary_image img", "src"))
+			e.ForEach(".post-content_item", func(_ int, item *colly.HTMLElement) {
+				switch {
+				case strings.HasPrefix(item.ChildText(".summary-heading"), "Alternative"):
+					series.AltTitles = splitList(item.ChildText(".summary-content"))
+				case strings.HasPrefix(item.ChildText(".summary-heading"), "Author"):
+					series.Authors = item.ChildTexts(".summary-content a")
+				case strings.HasPrefix(item.ChildText(".summary-heading"), "Status"):
+					series.Status = normalizeStatus(item.ChildText(".summary-content"))
+				}
+			})
+		})
 	case strings.Contains(url, "toomics.com"):
 		c.OnHTML(".list-ep", func(e *colly.HTMLElement) {
 			latestChapter = e.ChildText(".normal_ep:last-child a .cell-num span")
 			latestChapter = re.FindString(latestChapter)
 		})
+		c.OnHTML(".title_content", func(e *colly.HTMLElement) {
+			series.Title = e.ChildText("h2.title")
+			series.Authors = splitList(e.ChildText(".writer"))
+		})
 		break
 	default:
+		supported = false
 		break
 	}
 
-	c.Visit(url)
+	// Requests refused before they are sent, such as by robots.txt, don't reach
+	// OnError
+	visit := func(link string) {
+		if err := c.Visit(link); err != nil && visitErr == nil {
+			visitErr = err
+		}
+	}
+
+	// mangakakalot.to serves its chapter list separately from the series details
+	if seriesURL != url {
+		visit(seriesURL)
+	}
+
+	visit(url)
 
-	if latestChapter == "" {
-		return latestRelease
+	if series.Cover == "" {
+		series.Cover = ogImage
 	}
 
 	i, err := strconv.ParseFloat(latestChapter, 32)
 
+	if err == nil {
+		series.LatestChapter = float32(i)
+	}
+
+	if series.LatestChapter == 0 {
+		failure := ScrapeFailure{
+			Link:   seriesURL,
+			Source: sourceName(seriesURL),
+			Reason: "no chapter found",
+			At:     time.Now(),
+		}
+
+		if !supported {
+			failure.Reason = "unsupported site"
+		} else if visitErr != nil {
+			failure.Reason = visitErr.Error()
+		}
+
+		slog.Warn("Error scraping series", "source", failure.Source, "url", seriesURL, "reason", failure.Reason)
+		recordScrapeFailure(failure)
+	} else {
+		series.Source = sourceName(seriesURL)
+		recordSourceSuccess(series.Source)
+	}
+
+	return series
+}
+
+// sourceName returns the host of a series link, which identifies the scraper used
+// for it.
+func sourceName(link string) string {
+	u, err := url.Parse(link)
+
 	if err != nil {
-		return latestRelease
+		return ""
+	}
+
+	return strings.TrimPrefix(u.Hostname(), "www.")
+}
+
+// absoluteURL resolves link against the page of e. An empty link stays empty
+// instead of resolving to the page itself.
+func absoluteURL(e *colly.HTMLElement, link string) string {
+	if strings.TrimSpace(link) == "" {
+		return ""
+	}
+
+	return e.Request.AbsoluteURL(link)
+}
+
+// splitList splits a scraped list of names such as alternative titles or authors
+// into its trimmed parts.
+func splitList(list string) []string {
+	var parts []string
+
+	for _, part := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == ',' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+func normalizeStatus(status string) string {
+	status = strings.ToLower(status)
+
+	switch {
+	case strings.Contains(status, "complete"):
+		return "Completed"
+	case strings.Contains(status, "ongoing"):
+		return "Ongoing"
+	case strings.Contains(status, "hiatus"):
+		return "Hiatus"
+	case strings.Contains(status, "cancel"):
+		return "Cancelled"
+	default:
+		return ""
+	}
+}
+
+// isImage reports whether url serves an image, judged by the status code and
+// content type of a HEAD request.
+func isImage(ctx context.Context, url string) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+
+	if err != nil {
+		return false
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return false
 	}
+	defer res.Body.Close()
 
-	return float32(i)
+	return res.StatusCode == 200 && strings.HasPrefix(res.Header.Get("Content-Type"), "image/")
 }
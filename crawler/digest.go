@@ -0,0 +1,375 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Digest summarizes what happened to the tracked series over a period.
+type Digest struct {
+	From        time.Time
+	To          time.Time
+	NewChapters []DigestRelease
+	Backlog     []DigestBacklog
+	Quiet       []DigestQuiet
+	Failures    []ScrapeFailure
+}
+
+type DigestRelease struct {
+	Title       string
+	Link        string
+	FromChapter float32
+	ToChapter   float32
+}
+
+type DigestBacklog struct {
+	Title           string
+	Link            string
+	CurrentProgress float32
+	LatestRelease   float32
+	Behind          float32
+}
+
+type DigestQuiet struct {
+	Title         string
+	Link          string
+	LatestRelease float32
+	LastUpdate    time.Time
+}
+
+const digestMarkdownTemplate = `# Manga digest {{.From.Format "2006-01-02"}} - {{.To.Format "2006-01-02"}}
+{{if .NewChapters}}
+## New chapters
+{{range .NewChapters}}- [{{.Title}}]({{.Link}}): chapter {{.FromChapter}} → {{.ToChapter}}
+{{end}}{{end}}{{if .Backlog}}
+## Unread backlog
+{{range .Backlog}}- [{{.Title}}]({{.Link}}): {{.Behind}} behind (read {{.CurrentProgress}} of {{.LatestRelease}})
+{{end}}{{end}}{{if .Quiet}}
+## Gone quiet
+{{range .Quiet}}- [{{.Title}}]({{.Link}}): no release since {{.LastUpdate.Format "2006-01-02"}} (chapter {{.LatestRelease}})
+{{end}}{{end}}{{if .Failures}}
+## Scraper failures
+{{range .Failures}}- {{.Source}}: {{.Link}} ({{.Reason}}, {{.Count}}x, last {{.At.Format "2006-01-02 15:04"}})
+{{end}}{{end}}`
+
+const digestTextTemplate = `Manga digest {{.From.Format "2006-01-02"}} - {{.To.Format "2006-01-02"}}
+{{if .NewChapters}}
+New chapters:
+{{range .NewChapters}}  * {{.Title}}: chapter {{.FromChapter}} -> {{.ToChapter}} ({{.Link}})
+{{end}}{{end}}{{if .Backlog}}
+Unread backlog:
+{{range .Backlog}}  * {{.Title}}: {{.Behind}} behind (read {{.CurrentProgress}} of {{.LatestRelease}})
+{{end}}{{end}}{{if .Quiet}}
+Gone quiet:
+{{range .Quiet}}  * {{.Title}}: no release since {{.LastUpdate.Format "2006-01-02"}} (chapter {{.LatestRelease}})
+{{end}}{{end}}{{if .Failures}}
+Scraper failures:
+{{range .Failures}}  * {{.Source}}: {{.Link}} ({{.Reason}}, {{.Count}}x, last {{.At.Format "2006-01-02 15:04"}})
+{{end}}{{end}}`
+
+const digestHTMLTemplate = `<html><body>
+<h1>Manga digest {{.From.Format "2006-01-02"}} - {{.To.Format "2006-01-02"}}</h1>
+{{if .NewChapters}}<h2>New chapters</h2><ul>
+{{range .NewChapters}}<li><a href="{{.Link}}">{{.Title}}</a>: chapter {{.FromChapter}} &rarr; {{.ToChapter}}</li>
+{{end}}</ul>{{end}}
+{{if .Backlog}}<h2>Unread backlog</h2><ul>
+{{range .Backlog}}<li><a href="{{.Link}}">{{.Title}}</a>: {{.Behind}} behind (read {{.CurrentProgress}} of {{.LatestRelease}})</li>
+{{end}}</ul>{{end}}
+{{if .Quiet}}<h2>Gone quiet</h2><ul>
+{{range .Quiet}}<li><a href="{{.Link}}">{{.Title}}</a>: no release since {{.LastUpdate.Format "2006-01-02"}} (chapter {{.LatestRelease}})</li>
+{{end}}</ul>{{end}}
+{{if .Failures}}<h2>Scraper failures</h2><ul>
+{{range .Failures}}<li>{{.Source}}: <a href="{{.Link}}">{{.Link}}</a> ({{.Reason}}, {{.Count}}x, last {{.At.Format "2006-01-02 15:04"}})</li>
+{{end}}</ul>{{end}}
+</body></html>`
+
+var digestMarkdown = template.Must(template.New("markdown").Parse(digestMarkdownTemplate))
+var digestText = template.Must(template.New("text").Parse(digestTextTemplate))
+var digestHTML = htmltemplate.Must(htmltemplate.New("html").Parse(digestHTMLTemplate))
+
+// SendDigest builds a digest over the given period for every profile and
+// delivers it to the configured notifiers and, when NOTION_REPORTS_PAGE_ID is
+// set, to a new Notion page under that parent.
+func SendDigest(ctx context.Context, period time.Duration) {
+	loadConfig()
+
+	for _, profile := range profiles {
+		withProfile(profile, func() {
+			defer recoverPanic("Recovered from panic while building digest")
+
+			sendProfileDigest(ctx, period)
+		})
+	}
+}
+
+func sendProfileDigest(ctx context.Context, period time.Duration) {
+	slog.Info("Building digest", "period", period.String())
+
+	detectSchemaTypes(ctx)
+
+	mangas, ok := getAllNotionPages(ctx)
+	if !ok {
+		return
+	}
+
+	digest := buildDigest(mangas, time.Now().Add(-period), time.Now())
+
+	sendDigest(ctx, digest)
+
+	if reportsPageID := getenv("NOTION_REPORTS_PAGE_ID"); reportsPageID != "" {
+		createDigestPage(ctx, reportsPageID, digest)
+	}
+}
+
+func buildDigest(mangas []Manga, from time.Time, to time.Time) Digest {
+	digest := Digest{
+		From: from,
+		To:   to,
+	}
+
+	quietAfter := time.Hour * 24 * 30
+	if days, err := strconv.Atoi(getenv("DIGEST_QUIET_DAYS")); err == nil && days > 0 {
+		quietAfter = time.Hour * 24 * time.Duration(days)
+	}
+
+	stateMutex.Lock()
+	releases := state.Releases
+	failures := state.Failures
+	stateMutex.Unlock()
+
+	for _, manga := range mangas {
+		var release *DigestRelease
+
+		for _, r := range releases[manga.ID] {
+			if r.At.Before(from) || r.At.After(to) {
+				continue
+			}
+
+			if release == nil {
+				release = &DigestRelease{
+					Title:       manga.Title,
+					Link:        manga.Link,
+					FromChapter: r.PreviousChapter,
+					ToChapter:   r.Chapter,
+				}
+			}
+
+			if r.PreviousChapter < release.FromChapter {
+				release.FromChapter = r.PreviousChapter
+			}
+
+			if r.Chapter > release.ToChapter {
+				release.ToChapter = r.Chapter
+			}
+		}
+
+		if release != nil {
+			digest.NewChapters = append(digest.NewChapters, *release)
+		}
+
+		if !isActive(manga) {
+			continue
+		}
+
+		if behind := manga.LatestRelease - manga.CurrentProgress; behind > 0 {
+			digest.Backlog = append(digest.Backlog, DigestBacklog{
+				Title:           manga.Title,
+				Link:            manga.Link,
+				CurrentProgress: manga.CurrentProgress,
+				LatestRelease:   manga.LatestRelease,
+				Behind:          behind,
+			})
+		}
+
+		if lastUpdate, ok := parseNotionDate(manga.LatestReleaseUpdatedAt); ok && to.Sub(lastUpdate) > quietAfter {
+			digest.Quiet = append(digest.Quiet, DigestQuiet{
+				Title:         manga.Title,
+				Link:          manga.Link,
+				LatestRelease: manga.LatestRelease,
+				LastUpdate:    lastUpdate,
+			})
+		}
+	}
+
+	for _, failure := range failures {
+		firstAt := failure.FirstAt
+		if firstAt.IsZero() {
+			firstAt = failure.At
+		}
+
+		if !failure.At.Before(from) && !firstAt.After(to) {
+			if failure.Count == 0 {
+				failure.Count = 1
+			}
+
+			digest.Failures = append(digest.Failures, failure)
+		}
+	}
+
+	sort.Slice(digest.NewChapters, func(i, j int) bool {
+		return digest.NewChapters[i].Title < digest.NewChapters[j].Title
+	})
+	sort.Slice(digest.Backlog, func(i, j int) bool {
+		return digest.Backlog[i].Behind > digest.Backlog[j].Behind
+	})
+	sort.Slice(digest.Quiet, func(i, j int) bool {
+		return digest.Quiet[i].LastUpdate.Before(digest.Quiet[j].LastUpdate)
+	})
+
+	return digest
+}
+
+// isActive reports whether a series is being read or watched, as opposed to
+// planned, paused or finished.
+func isActive(manga Manga) bool {
+	return contains(manga.Status, Reading) || contains(manga.Status, Watching)
+}
+
+// parseNotionDate parses the date formats Notion returns for date properties, as
+// well as the format the tracker writes itself.
+func parseNotionDate(date string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (d Digest) Markdown() string {
+	var body bytes.Buffer
+
+	if err := digestMarkdown.Execute(&body, d); err != nil {
+		slog.Error("Error rendering markdown digest", "err", err)
+	}
+
+	return body.String()
+}
+
+func (d Digest) Text() string {
+	var body bytes.Buffer
+
+	if err := digestText.Execute(&body, d); err != nil {
+		slog.Error("Error rendering text digest", "err", err)
+	}
+
+	return body.String()
+}
+
+func (d Digest) HTML() string {
+	var body bytes.Buffer
+
+	if err := digestHTML.Execute(&body, d); err != nil {
+		slog.Error("Error rendering html digest", "err", err)
+	}
+
+	return body.String()
+}
+
+func (d Digest) subject() string {
+	return "Manga digest " + d.From.Format("2006-01-02") + " - " + d.To.Format("2006-01-02")
+}
+
+func sendDigest(ctx context.Context, digest Digest) {
+	for _, notifier := range notifiers {
+		var err error
+
+		switch n := notifier.(type) {
+		case emailNotifier:
+			err = n.send(ctx, digest.subject(), "text/html", digest.HTML())
+		case discordNotifier, webhookNotifier:
+			err = notifier.Notify(ctx, digest.subject(), digest.Markdown(), nil)
+		default:
+			err = notifier.Notify(ctx, digest.subject(), digest.Text(), nil)
+		}
+
+		if err != nil {
+			slog.Error("Error sending digest", "notifier", notifier.Name(), "err", err)
+		}
+	}
+}
+
+func createDigestPage(ctx context.Context, parentPageID string, digest Digest) {
+	var children []Children
+
+	section := func(heading string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+
+		children = append(children, Children{
+			Object:   "block",
+			Type:     "heading_2",
+			Heading2: blockText(heading),
+		})
+
+		for _, item := range items {
+			children = append(children, Children{
+				Object:           "block",
+				Type:             "bulleted_list_item",
+				BulletedListItem: blockText(item),
+			})
+		}
+	}
+
+	var items []string
+	for _, release := range digest.NewChapters {
+		items = append(items, release.Title+": chapter "+formatChapter(release.FromChapter)+" → "+formatChapter(release.ToChapter))
+	}
+	section("New chapters", items)
+
+	items = nil
+	for _, backlog := range digest.Backlog {
+		items = append(items, backlog.Title+": "+formatChapter(backlog.Behind)+" behind")
+	}
+	section("Unread backlog", items)
+
+	items = nil
+	for _, quiet := range digest.Quiet {
+		items = append(items, quiet.Title+": no release since "+quiet.LastUpdate.Format("2006-01-02"))
+	}
+	section("Gone quiet", items)
+
+	items = nil
+	for _, failure := range digest.Failures {
+		items = append(items, failure.Source+": "+failure.Link+" ("+failure.Reason+", "+strconv.Itoa(failure.Count)+"x)")
+	}
+	section("Scraper failures", items)
+
+	// Notion accepts at most 100 children when creating a page
+	if len(children) > 100 {
+		children = children[:100]
+	}
+
+	notionCreateBody := struct {
+		Parent     Parent                 `json:"parent"`
+		Properties map[string]interface{} `json:"properties"`
+		Children   []Children             `json:"children,omitempty"`
+	}{
+		Parent: Parent{
+			PageID: parentPageID,
+		},
+		Properties: map[string]interface{}{
+			"title": Title{
+				Title: richText(digest.subject()),
+			},
+		},
+		Children: children,
+	}
+
+	if _, ok := postNotionPage(ctx, notionCreateBody); ok {
+		slog.Info("Created digest page", "page_id", parentPageID)
+	}
+}
+
+func formatChapter(chapter float32) string {
+	return strings.TrimSuffix(strconv.FormatFloat(float64(chapter), 'f', 1, 32), ".0")
+}
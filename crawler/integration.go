@@ -0,0 +1,126 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+)
+
+// ListIntegration imports the series a user tracks on an external list service.
+// Its series are reconciled with the Notion pages whose Link contains LinkDomain.
+type ListIntegration interface {
+	Name() string
+	LinkDomain() string
+	Enabled() bool
+	Fetch(ctx context.Context) []Manga
+}
+
+// ProgressPusher is implemented by list integrations that can write reading
+// progress made in Notion back to the list service.
+type ProgressPusher interface {
+	PushProgress(ctx context.Context, manga Manga, progress float32) bool
+}
+
+func integrations() []ListIntegration {
+	return []ListIntegration{
+		mangaDexIntegration{},
+		aniListIntegration{
+			userName: getenv("ANILIST_USERNAME"),
+			token:    getenv("ANILIST_TOKEN"),
+		},
+		newMyAnimeListIntegration(),
+		newKitsuIntegration(),
+	}
+}
+
+// ReleaseSource reads the latest release of a series from the link or title of
+// a Notion page that doesn't belong to a list integration.
+type ReleaseSource interface {
+	Name() string
+	Matches(manga Manga) bool
+	Fetch(ctx context.Context, manga Manga) ScrapedSeries
+}
+
+// releaseSources returns the release sources in order of preference. The
+// scrapers match every page and therefore come last.
+func releaseSources() []ReleaseSource {
+	return []ReleaseSource{
+		newMangaUpdatesSource(),
+		scraperSource{},
+	}
+}
+
+type scraperSource struct{}
+
+func (scraperSource) Name() string {
+	return "scraper"
+}
+
+func (scraperSource) Matches(manga Manga) bool {
+	return true
+}
+
+func (scraperSource) Fetch(ctx context.Context, manga Manga) ScrapedSeries {
+	return scrapeSeries(ctx, manga.Link)
+}
+
+type mangaDexIntegration struct{}
+
+func (mangaDexIntegration) Name() string {
+	return "MangaDex"
+}
+
+func (mangaDexIntegration) LinkDomain() string {
+	return "mangadex"
+}
+
+func (mangaDexIntegration) Enabled() bool {
+	return getenv("MANGADEX_USERNAME") != ""
+}
+
+func (mangaDexIntegration) Fetch(ctx context.Context) []Manga {
+	return SyncMangaDex(ctx)
+}
+
+var scrapeResults = map[string]ScrapedSeries{}
+var scrapeResultsMutex sync.Mutex
+
+// resetScrapeResults forgets the releases fetched by the previous run.
+func resetScrapeResults() {
+	scrapeResultsMutex.Lock()
+	defer scrapeResultsMutex.Unlock()
+
+	scrapeResults = map[string]ScrapedSeries{}
+}
+
+// ReleaseKeyer is implemented by release sources that don't find every series
+// by its link. ReleaseKey identifies the series fetched for manga.
+type ReleaseKeyer interface {
+	ReleaseKey(manga Manga) string
+}
+
+// fetchRelease fetches the latest release of manga from source once per run, so
+// pages and profiles tracking the same series share the result.
+func fetchRelease(ctx context.Context, source ReleaseSource, manga Manga) ScrapedSeries {
+	key := source.Name() + " " + normalizeURL(manga.Link)
+	if keyer, ok := source.(ReleaseKeyer); ok {
+		key = source.Name() + " " + keyer.ReleaseKey(manga)
+	}
+
+	scrapeResultsMutex.Lock()
+	series, ok := scrapeResults[key]
+	scrapeResultsMutex.Unlock()
+
+	if ok {
+		return series
+	}
+
+	series = source.Fetch(ctx, manga)
+
+	if ctx.Err() == nil {
+		scrapeResultsMutex.Lock()
+		scrapeResults[key] = series
+		scrapeResultsMutex.Unlock()
+	}
+
+	return series
+}
@@ -0,0 +1,257 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type KitsuMedia struct {
+	ID         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Slug              string            `json:"slug"`
+		Synopsis          string            `json:"synopsis"`
+		CanonicalTitle    string            `json:"canonicalTitle"`
+		Titles            map[string]string `json:"titles"`
+		AbbreviatedTitles []string          `json:"abbreviatedTitles"`
+		StartDate         string            `json:"startDate"`
+		Status            string            `json:"status"`
+		ChapterCount      int               `json:"chapterCount"`
+		VolumeCount       int               `json:"volumeCount"`
+		EpisodeCount      int               `json:"episodeCount"`
+		UpdatedAt         string            `json:"updatedAt"`
+		PosterImage       *struct {
+			Large string `json:"large"`
+		} `json:"posterImage"`
+	} `json:"attributes"`
+}
+
+type KitsuLibraryResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Status       string `json:"status"`
+			Progress     int    `json:"progress"`
+			RatingTwenty int    `json:"ratingTwenty"`
+			UpdatedAt    string `json:"updatedAt"`
+		} `json:"attributes"`
+		Relationships struct {
+			Media struct {
+				Data *struct {
+					ID   string `json:"id"`
+					Type string `json:"type"`
+				} `json:"data"`
+			} `json:"media"`
+		} `json:"relationships"`
+	} `json:"data"`
+	Included []KitsuMedia `json:"included"`
+	Links    struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type KitsuUsersResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// kitsuIntegration imports the manga and anime library of a Kitsu user.
+type kitsuIntegration struct {
+	userName string
+}
+
+func (kitsuIntegration) Name() string {
+	return "Kitsu"
+}
+
+func (kitsuIntegration) LinkDomain() string {
+	return "kitsu.io"
+}
+
+func (k kitsuIntegration) Enabled() bool {
+	return k.userName != ""
+}
+
+func (k kitsuIntegration) Fetch(ctx context.Context) []Manga {
+	var usersResponse KitsuUsersResponse
+
+	if !kitsuRequest(ctx, "https://kitsu.io/api/edge/users?filter[name]="+url.QueryEscape(k.userName), &usersResponse) || len(usersResponse.Data) == 0 {
+		slog.Error("Error finding kitsu user", "source", "kitsu", "user", k.userName)
+
+		return nil
+	}
+
+	userID := usersResponse.Data[0].ID
+
+	var mangas []Manga
+
+	for _, kind := range []string{"manga", "anime"} {
+		next := fmt.Sprintf("https://kitsu.io/api/edge/library-entries?filter[userId]=%s&filter[kind]=%s&include=media&page[limit]=500", userID, kind)
+
+		for next != "" {
+			var libraryResponse KitsuLibraryResponse
+
+			if !kitsuRequest(ctx, next, &libraryResponse) {
+				break
+			}
+
+			media := make(map[string]KitsuMedia)
+			for _, included := range libraryResponse.Included {
+				media[included.Type+included.ID] = included
+			}
+
+			for _, entry := range libraryResponse.Data {
+				if entry.Relationships.Media.Data == nil {
+					continue
+				}
+
+				m, ok := media[entry.Relationships.Media.Data.Type+entry.Relationships.Media.Data.ID]
+
+				if !ok {
+					continue
+				}
+
+				manga := kitsuMediaToManga(m)
+				manga.CurrentProgress = float32(entry.Attributes.Progress)
+				manga.Rating = float32(entry.Attributes.RatingTwenty) / 2
+				manga.Status = []string{kitsuStatus(entry.Attributes.Status, manga.Type == "Anime")}
+
+				mangas = append(mangas, manga)
+			}
+
+			next = libraryResponse.Links.Next
+		}
+	}
+
+	return mangas
+}
+
+func kitsuRequest(ctx context.Context, endpoint string, response interface{}) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	req.Header.Add("Accept", "application/vnd.api+json")
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		slog.Error("Error calling kitsu", "source", "kitsu", "url", endpoint, "err", err)
+
+		return false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		slog.Error("Error calling kitsu", "source", "kitsu", "url", endpoint, "status_code", res.StatusCode)
+
+		return false
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		slog.Error("Error parsing response body for kitsu", "source", "kitsu", "url", endpoint, "err", err)
+
+		return false
+	}
+
+	return true
+}
+
+func kitsuMediaToManga(media KitsuMedia) Manga {
+	attributes := media.Attributes
+
+	manga := Manga{
+		Type:              "Manga",
+		Title:             attributes.CanonicalTitle,
+		Link:              fmt.Sprintf("https://kitsu.io/%s/%s", media.Type, attributes.Slug),
+		SeenLatestRelease: false,
+		Description:       attributes.Synopsis,
+		AltTitles:         attributes.AbbreviatedTitles,
+		PublicationStatus: kitsuPublicationStatus(attributes.Status),
+	}
+
+	if title := attributes.Titles["en"]; title != "" && title != manga.Title {
+		manga.AltTitles = append([]string{manga.Title}, manga.AltTitles...)
+		manga.Title = title
+	}
+
+	if attributes.PosterImage != nil {
+		manga.Art = attributes.PosterImage.Large
+	}
+
+	if len(attributes.StartDate) >= 4 {
+		fmt.Sscanf(attributes.StartDate[:4], "%d", &manga.Year)
+	}
+
+	if updatedAt, err := time.Parse(time.RFC3339, attributes.UpdatedAt); err == nil {
+		manga.LatestReleaseUpdatedAt = updatedAt.In(loc).Format("2006-01-02 15:04:05")
+	}
+
+	if media.Type == "anime" {
+		manga.Type = "Anime"
+		manga.LastChapter = float32(attributes.EpisodeCount)
+
+		if attributes.Status == "finished" {
+			manga.LatestRelease = float32(attributes.EpisodeCount)
+		}
+	} else {
+		manga.LatestRelease = float32(attributes.ChapterCount)
+		manga.LastChapter = float32(attributes.ChapterCount)
+
+		if attributes.VolumeCount != 0 {
+			manga.LastVolume = fmt.Sprintf("%v", attributes.VolumeCount)
+		}
+	}
+
+	return manga
+}
+
+func kitsuStatus(status string, anime bool) string {
+	switch status {
+	case "current":
+		if anime {
+			return Watching
+		}
+
+		return Reading
+	case "completed":
+		return Completed
+	case "on_hold":
+		return OnHold
+	case "dropped":
+		return Dropped
+	default:
+		if anime {
+			return PlanningToWatch
+		}
+
+		return PlanningToRead
+	}
+}
+
+func kitsuPublicationStatus(status string) string {
+	switch status {
+	case "finished":
+		return "Completed"
+	case "current":
+		return "Ongoing"
+	case "upcoming", "unreleased", "tba":
+		return "Not Yet Released"
+	default:
+		return ""
+	}
+}
+
+func newKitsuIntegration() kitsuIntegration {
+	return kitsuIntegration{
+		userName: getenv("KITSU_USERNAME"),
+	}
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var runID atomic.Value
+
+// runHandler adds the ID of the running sync and the active profile to every
+// record, so all lines of a run can be correlated.
+type runHandler struct {
+	slog.Handler
+}
+
+func (h runHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id, _ := runID.Load().(string); id != "" {
+		record.AddAttrs(slog.String("run_id", id))
+	}
+
+	if name := profileName(); name != "" {
+		record.AddAttrs(slog.String("profile", name))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h runHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return runHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h runHandler) WithGroup(name string) slog.Handler {
+	return runHandler{h.Handler.WithGroup(name)}
+}
+
+// SetupLogging configures the default logger from LOG_FORMAT (text or json) and
+// LOG_LEVEL (debug, info, warn or error).
+func SetupLogging() {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{
+		Level: level,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(runHandler{handler}))
+}
+
+// newRunID generates a random ID for a sync run.
+func newRunID() string {
+	id := make([]byte, 8)
+
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
+
+func setRunID(id string) {
+	runID.Store(id)
+}
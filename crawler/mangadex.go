@@ -1,12 +1,11 @@
 package crawler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -47,16 +46,27 @@ type MangaResponse struct {
 			AltTitles []struct {
 				En string `json:"en"`
 			} `json:"altTitles"`
-			LastVolume  string `json:"lastVolume"`
-			LastChapter string `json:"lastChapter"`
-			Status      string `json:"status"`
-			CreatedAt   string `json:"createdAt"`
-			UpdatedAt   string `json:"updatedAt"`
+			Description            map[string]string `json:"description"`
+			LastVolume             string            `json:"lastVolume"`
+			LastChapter            string            `json:"lastChapter"`
+			PublicationDemographic string            `json:"publicationDemographic"`
+			Status                 string            `json:"status"`
+			Year                   int               `json:"year"`
+			Tags                   []struct {
+				ID         string `json:"id"`
+				Attributes struct {
+					Name  map[string]string `json:"name"`
+					Group string            `json:"group"`
+				} `json:"attributes"`
+			} `json:"tags"`
+			CreatedAt string `json:"createdAt"`
+			UpdatedAt string `json:"updatedAt"`
 		} `json:"attributes"`
 		Relationships []struct {
 			ID         string `json:"id"`
 			Type       string `json:"type"`
 			Attributes struct {
+				Name        string `json:"name"`
 				Description string `json:"description"`
 				Volume      string `json:"volume"`
 				FileName    string `json:"fileName"`
@@ -78,63 +88,57 @@ type ChapterResponse struct {
 			Volume             string `json:"volume"`
 			Chapter            string `json:"chapter"`
 			Title              string `json:"title"`
-			translatedLanguage string `json:"translatedLanguage"`
-			hash               string `json:"hash"`
+			TranslatedLanguage string `json:"translatedLanguage"`
+			Hash               string `json:"hash"`
 			UpdatedAt          string `json:"updatedAt"`
 		}
 	} `json:"data"`
 }
 
+// mangaDexAPI and mangaDexUploads are the base URLs of the MangaDex API and its
+// covers, replaced by the tests.
+var mangaDexAPI = "https://api.mangadex.org"
+var mangaDexUploads = "https://uploads.mangadex.org"
+
 var token string
 
-func authorization() {
+func authorization(ctx context.Context) bool {
 	// 	err := godotenv.Load(".env")
 
 	// 	if err != nil {
 	// 		log.Printf("Error loading .env file, err: %s \n", err)
 	// 	}
 
-	log.Print("Authorizing... \n")
-
-	body := strings.NewReader(fmt.Sprintf("{\"username\": \"%s\", \"password\": \"%s\"}", os.Getenv("MANGADEX_USERNAME"), os.Getenv("MANGADEX_PASSWORD")))
-	res, err := http.Post("https://api.mangadex.org/auth/login", "application/json", body)
-
-	if err != nil {
-		log.Printf("Error authorizing, err: %s \n", err)
-	}
-	defer res.Body.Close()
-
-	var authResponse AuthResponse
-
-	err = json.NewDecoder(res.Body).Decode(&authResponse)
+	slog.Info("Authorizing", "source", "mangadex")
 
-	if err != nil {
-		log.Printf("Error parsing response body authorization, err: %s \n", err)
-	}
+	body := fmt.Sprintf("{\"username\": \"%s\", \"password\": \"%s\"}", getenv("MANGADEX_USERNAME"), getenv("MANGADEX_PASSWORD"))
 
-	if authResponse.Errors != nil {
-		log.Printf("Error getting new auth token, err: %s \n", authResponse.Errors[0].Detail)
-
-		if authResponse.Errors[0].Status == 429 {
-			log.Printf("Too many requests, sleeping for 20 minutes")
+	return requestAuthToken(ctx, mangaDexAPI+"/auth/login", body)
+}
 
-			time.Sleep(time.Second * 60 * 20)
+func refreshToken(ctx context.Context) bool {
+	slog.Info("Refreshing token", "source", "mangadex")
 
-			authorization()
-		}
-	}
+	body := fmt.Sprintf("{\"token\": \"%s\"}", token)
 
-	token = authResponse.Token.Session
+	return requestAuthToken(ctx, mangaDexAPI+"/auth/refresh", body)
 }
 
-func refreshToken() {
-	log.Print("Refreshing Token... \n")
-
-	body := strings.NewReader(fmt.Sprintf("{\"token\": \"%s\"}", token))
-	res, err := http.Post("https://api.mangadex.org/auth/refresh", "application/json", body)
+// requestAuthToken posts body to a MangaDex auth endpoint and stores the session
+// token it returns. The current token is kept when the request fails.
+func requestAuthToken(ctx context.Context, endpoint string, body string) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
+	req, _ := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(body))
+	req.Header.Add("Content-Type", "application/json")
+	res, err := client.Do(req)
 
 	if err != nil {
-		log.Printf("Error refreshing token, err: %s \n", err)
+		slog.Error("Error authorizing", "source", "mangadex", "url", endpoint, "err", err)
+
+		return false
 	}
 	defer res.Body.Close()
 
@@ -143,39 +147,55 @@ func refreshToken() {
 	err = json.NewDecoder(res.Body).Decode(&authResponse)
 
 	if err != nil {
-		log.Printf("Error parsing response body authorization, err: %v \n", err)
+		slog.Error("Error parsing response body authorization", "source", "mangadex", "status_code", res.StatusCode, "err", err)
+
+		return false
 	}
 
-	if authResponse.Errors != nil {
-		log.Printf("Error getting new auth token, err: %s \n", authResponse.Errors[0].Detail)
+	if len(authResponse.Errors) > 0 {
+		slog.Error("Error getting new auth token", "source", "mangadex", "status_code", authResponse.Errors[0].Status, "err", authResponse.Errors[0].Detail)
 
 		if authResponse.Errors[0].Status == 429 {
-			log.Printf("Too many requests, sleeping for 20 minutes")
-			time.Sleep(time.Second * 60 * 20)
+			slog.Warn("Too many requests, sleeping for 20 minutes", "source", "mangadex")
 
-			authorization()
+			if sleep(ctx, time.Second*60*20) {
+				return authorization(ctx)
+			}
 		}
+
+		return false
+	}
+
+	if authResponse.Token.Session == "" {
+		slog.Error("Error getting new auth token", "source", "mangadex", "status_code", res.StatusCode, "err", "no session token in response")
+
+		return false
 	}
 
 	token = authResponse.Token.Session
+
+	return true
 }
 
-func getAllMangasIds() map[string]interface{} {
+func getAllMangasIds(ctx context.Context) map[string]interface{} {
 	client := &http.Client{
-		Timeout: time.Second * 10,
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
 	}
-	req, _ := http.NewRequest("GET", "https://api.mangadex.org/manga/status", nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", mangaDexAPI+"/manga/status", nil)
 	req.Header.Add("Authorization", "Bearer "+token)
 	res, err := client.Do(req)
 
 	if err != nil || res.StatusCode != 200 {
-		if res.StatusCode == 401 {
-			refreshToken()
+		closeResponse(res)
 
-			return getAllMangasIds()
-		} else {
-			log.Printf("Error retrieving manga statuses from mangadex, err: %v \n", err)
+		if statusCode(res) == 401 && refreshToken(ctx) {
+			return getAllMangasIds(ctx)
 		}
+
+		slog.Error("Error retrieving manga statuses from mangadex", "source", "mangadex", "err", err, "status_code", statusCode(res))
+
+		return nil
 	}
 	defer res.Body.Close()
 
@@ -184,10 +204,7 @@ func getAllMangasIds() map[string]interface{} {
 	err = json.NewDecoder(res.Body).Decode(&statusReponse)
 
 	if err != nil {
-		resBody, _ := ioutil.ReadAll(res.Body)
-		fmt.Printf("res %s\n", string(resBody))
-
-		log.Printf("Error parsing response body for https://api.mangadex.org/manga/status, err: %s \n", err)
+		slog.Error("Error parsing response body for manga statuses", "source", "mangadex", "url", mangaDexAPI+"/manga/status", "err", err)
 	}
 
 	m := make(map[string]interface{})
@@ -199,26 +216,27 @@ func getAllMangasIds() map[string]interface{} {
 	return m
 }
 
-func getManga(mangaId string, status string) Manga {
-	log.Printf("Getting manga by id %s \n", mangaId)
+func getManga(ctx context.Context, mangaId string, status string) Manga {
+	slog.Debug("Getting manga by id", "source", "mangadex", "manga_id", mangaId)
 
 	client := &http.Client{
-		Timeout: time.Second * 10,
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
 	}
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.mangadex.org/manga/%s?includes[]=cover_art", mangaId), nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", mangaDexAPI+"/manga/"+mangaId+"?includes[]=cover_art&includes[]=author&includes[]=artist", nil)
 	req.Header.Add("Authorization", "Bearer "+token)
 	res, err := client.Do(req)
 
 	if err != nil || res.StatusCode != 200 {
-		if res.StatusCode == 401 {
-			refreshToken()
-
-			return getManga(mangaId, status)
-		} else {
-			log.Printf("Error retrieving manga detail from mangadex, err: %v \n", err)
+		closeResponse(res)
 
-			return Manga{}
+		if statusCode(res) == 401 && refreshToken(ctx) {
+			return getManga(ctx, mangaId, status)
 		}
+
+		slog.Error("Error retrieving manga detail from mangadex", "source", "mangadex", "manga_id", mangaId, "err", err, "status_code", statusCode(res))
+
+		return Manga{}
 	}
 
 	defer res.Body.Close()
@@ -228,7 +246,9 @@ func getManga(mangaId string, status string) Manga {
 	err = json.NewDecoder(res.Body).Decode(&mangaResponse)
 
 	if err != nil {
-		log.Printf("Error parsing response body for manga detail, mangaId: %s err: %v \n", mangaId, err)
+		slog.Error("Error parsing response body for manga detail", "source", "mangadex", "manga_id", mangaId, "err", err)
+
+		return Manga{}
 	}
 
 	manga := Manga{
@@ -252,19 +272,67 @@ func getManga(mangaId string, status string) Manga {
 		}
 	}
 
+	for _, altTitle := range mangaResponse.Data.Attributes.AltTitles {
+		if altTitle.En != "" && altTitle.En != manga.Title {
+			manga.AltTitles = append(manga.AltTitles, altTitle.En)
+		}
+	}
+
 	var coverArt string
 	for _, relation := range mangaResponse.Data.Relationships {
-		if relation.Type == "cover_art" {
+		switch relation.Type {
+		case "cover_art":
 			coverArt = relation.Attributes.FileName
+		case "author", "artist":
+			if relation.Attributes.Name != "" && !contains(manga.Authors, relation.Attributes.Name) {
+				manga.Authors = append(manga.Authors, relation.Attributes.Name)
+			}
 		}
 	}
 
-	// Check if cover image exists
-	_, err = http.Head(fmt.Sprintf("https://uploads.mangadex.org/covers/%s/%s", mangaId, coverArt))
-	if err != nil {
-		manga.Art = fmt.Sprintf("https://uploads.mangadex.org/covers/%s/%s", mangaId, coverArt)
+	attributes := mangaResponse.Data.Attributes
+
+	if description, ok := attributes.Description["en"]; ok {
+		manga.Description = description
 	} else {
-		manga.Art = fmt.Sprintf("https://uploads.mangadex.org/covers/%s/%s.512.jpg", mangaId, coverArt)
+		for _, description := range attributes.Description {
+			manga.Description = description
+			break
+		}
+	}
+
+	for _, tag := range attributes.Tags {
+		if tag.Attributes.Group == "genre" && tag.Attributes.Name["en"] != "" {
+			manga.Genres = append(manga.Genres, tag.Attributes.Name["en"])
+		}
+	}
+
+	manga.PublicationStatus = publicationStatus(attributes.Status)
+	if demographic := attributes.PublicationDemographic; demographic != "" {
+		manga.Demographic = strings.ToUpper(demographic[:1]) + demographic[1:]
+	}
+
+	manga.Year = attributes.Year
+	manga.LastVolume = attributes.LastVolume
+
+	if attributes.LastChapter != "" {
+		lastChapter, err := strconv.ParseFloat(attributes.LastChapter, 32)
+
+		if err == nil {
+			manga.LastChapter = float32(lastChapter)
+		}
+	}
+
+	// Prefer the 512px thumbnail and fall back to the full size cover
+	if coverArt != "" {
+		thumbnail := mangaDexUploads + "/covers/" + mangaId + "/" + coverArt + ".512.jpg"
+		original := mangaDexUploads + "/covers/" + mangaId + "/" + coverArt
+
+		if isImage(ctx, thumbnail) {
+			manga.Art = thumbnail
+		} else if isImage(ctx, original) {
+			manga.Art = original
+		}
 	}
 
 	var statusses []string
@@ -299,30 +367,48 @@ func getManga(mangaId string, status string) Manga {
 		break
 	}
 
-	latestRelease, updatedAt := getChapterForManga(mangaId)
+	latestRelease, updatedAt := getChapterForManga(ctx, mangaId)
 	manga.LatestRelease = latestRelease
 	manga.LatestReleaseUpdatedAt = updatedAt
 
 	return manga
 }
 
-func getChapterForManga(mangaId string) (float32, string) {
+func publicationStatus(status string) string {
+	switch status {
+	case "ongoing":
+		return "Ongoing"
+	case "completed":
+		return "Completed"
+	case "hiatus":
+		return "Hiatus"
+	case "cancelled":
+		return "Cancelled"
+	default:
+		return ""
+	}
+}
+
+func getChapterForManga(ctx context.Context, mangaId string) (float32, string) {
 	client := &http.Client{
-		Timeout: time.Second * 10,
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
 	}
 
-	req, _ := http.NewRequest("GET", fmt.Sprintf("https://api.mangadex.org/chapter?manga=%s&order[chapter]=desc&translatedLanguage[]=en", mangaId), nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", mangaDexAPI+"/chapter?manga="+mangaId+"&order[chapter]=desc&translatedLanguage[]=en", nil)
 	req.Header.Add("Authorization", "Bearer "+token)
 	res, err := client.Do(req)
 
 	if err != nil || res.StatusCode != 200 {
-		if res.StatusCode == 401 {
-			refreshToken()
+		closeResponse(res)
 
-			return getChapterForManga(mangaId)
-		} else {
-			log.Printf("Error retrieving manga chapters from mangadex mangaId: %s, err: %v \n", mangaId, err)
+		if statusCode(res) == 401 && refreshToken(ctx) {
+			return getChapterForManga(ctx, mangaId)
 		}
+
+		slog.Error("Error retrieving manga chapters from mangadex", "source", "mangadex", "manga_id", mangaId, "err", err, "status_code", statusCode(res))
+
+		return 0, time.Now().In(loc).Format("2006-01-02 15:04:05")
 	}
 	defer res.Body.Close()
 
@@ -331,7 +417,7 @@ func getChapterForManga(mangaId string) (float32, string) {
 	err = json.NewDecoder(res.Body).Decode(&chapterResponse)
 
 	if err != nil {
-		log.Printf("Error parsing response body for manga chapters, mangaId: %s err: %v \n", mangaId, err)
+		slog.Error("Error parsing response body for manga chapters", "source", "mangadex", "manga_id", mangaId, "err", err)
 	}
 
 	if len(chapterResponse.Data) == 0 {
@@ -343,19 +429,23 @@ func getChapterForManga(mangaId string) (float32, string) {
 	return float32(i), chapterResponse.Data[0].Attributes.UpdatedAt
 }
 
-func SyncMangaDex() []Manga {
-	authorization()
+func SyncMangaDex(ctx context.Context) []Manga {
+	if !authorization(ctx) {
+		return nil
+	}
 
-	idsAndStatusesMap := getAllMangasIds()
+	idsAndStatusesMap := getAllMangasIds(ctx)
 
 	var mangas []Manga
 
 	for id, status := range idsAndStatusesMap {
-		manga := getManga(id, fmt.Sprintf("%s", status))
+		manga := getManga(ctx, id, fmt.Sprintf("%s", status))
 		if manga.Title != "" {
 			mangas = append(mangas, manga)
 			delete(idsAndStatusesMap, id)
-			time.Sleep(time.Second * 1)
+			if !sleep(ctx, time.Second*1) {
+				break
+			}
 		}
 	}
 
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func FuzzGetManga(f *testing.F) {
+	f.Add([]byte(`{"data":{"id":"1","attributes":{"title":{"en":"Berserk"},"altTitles":[{"en":"Berserk"}],"status":"ongoing","lastChapter":"","year":1989},"relationships":[{"type":"cover_art","attributes":{"fileName":"a.jpg"}},{"type":"author","attributes":{"name":"Miura"}}]}}`))
+	f.Add([]byte(`{"data":{"relationships":[{"type":"cover_art"},{"type":"author","attributes":null}]}}`))
+	f.Add([]byte(`{"data":{"attributes":{"tags":[{"attributes":{"group":"genre","name":{}}}]}}}`))
+	f.Add([]byte(`{"data":null}`))
+	f.Add([]byte(`[]`))
+	f.Add([]byte(``))
+
+	setLocation(f, time.UTC)
+
+	server := newFuzzServer(f)
+	setMangaDexAPI(f, server.URL)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		server.serve(http.StatusOK, body)
+
+		manga := getManga(context.Background(), "1", "reading")
+
+		if isGarbage(body) && manga.Title != "" {
+			t.Errorf("getManga(%q) returned %q from garbage", body, manga.Title)
+		}
+	})
+}
+
+func FuzzGetChapterForManga(f *testing.F) {
+	f.Add([]byte(`{"data":[{"attributes":{"chapter":"12.5","updatedAt":"2024-01-01T00:00:00+00:00"}}]}`))
+	f.Add([]byte(`{"data":[{"attributes":{"chapter":null}}]}`))
+	f.Add([]byte(`{"data":[]}`))
+	f.Add([]byte(`{"data":"x"}`))
+	f.Add([]byte(``))
+
+	setLocation(f, time.UTC)
+
+	server := newFuzzServer(f)
+	setMangaDexAPI(f, server.URL)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		server.serve(http.StatusOK, body)
+
+		chapter, _ := getChapterForManga(context.Background(), "1")
+
+		if isGarbage(body) && chapter != 0 {
+			t.Errorf("getChapterForManga(%q) = %v from garbage", body, chapter)
+		}
+	})
+}
+
+// setMangaDexAPI points the MangaDex client and cover checks at url until the
+// test is done.
+func setMangaDexAPI(tb testing.TB, url string) {
+	previousAPI, previousUploads := mangaDexAPI, mangaDexUploads
+	mangaDexAPI, mangaDexUploads = url, url
+	tb.Cleanup(func() { mangaDexAPI, mangaDexUploads = previousAPI, previousUploads })
+}
+
+func setLocation(tb testing.TB, location *time.Location) {
+	previous := loc
+	loc = location
+	tb.Cleanup(func() { loc = previous })
+}
@@ -0,0 +1,271 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MangaUpdatesSearchResponse struct {
+	Results []struct {
+		HitTitle string `json:"hit_title"`
+		Record   struct {
+			SeriesID int64  `json:"series_id"`
+			Title    string `json:"title"`
+			Url      string `json:"url"`
+		} `json:"record"`
+	} `json:"results"`
+}
+
+type MangaUpdatesReleasesResponse struct {
+	Results []struct {
+		Record struct {
+			ID          int64  `json:"id"`
+			Title       string `json:"title"`
+			Volume      string `json:"volume"`
+			Chapter     string `json:"chapter"`
+			ReleaseDate string `json:"release_date"`
+			Groups      []struct {
+				Name string `json:"name"`
+			} `json:"groups"`
+		} `json:"record"`
+	} `json:"results"`
+}
+
+type MangaUpdatesSeriesResponse struct {
+	SeriesID   int64  `json:"series_id"`
+	Title      string `json:"title"`
+	Status     string `json:"status"`
+	Completed  bool   `json:"completed"`
+	Associated []struct {
+		Title string `json:"title"`
+	} `json:"associated"`
+	Authors []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"authors"`
+	Image struct {
+		Url struct {
+			Original string `json:"original"`
+		} `json:"url"`
+	} `json:"image"`
+}
+
+// mangaUpdatesSource reads the latest release of a series from the MangaUpdates
+// (Baka-Updates) release feed. Pages are resolved to a series through their link,
+// or by title when fallback is enabled and no scraper supports the link.
+type mangaUpdatesSource struct {
+	fallback bool
+}
+
+var mangaUpdatesLinkRegexp = regexp.MustCompile(`mangaupdates\.com/series/([0-9a-z]+)`)
+var releaseChapterRegexp = regexp.MustCompile(`[0-9]+(\.[0-9]+)?`)
+
+func (mangaUpdatesSource) Name() string {
+	return "mangaupdates"
+}
+
+func (m mangaUpdatesSource) Matches(manga Manga) bool {
+	if strings.Contains(manga.Link, "mangaupdates.com") {
+		return true
+	}
+
+	return m.fallback && manga.Title != "" && !isScrapedSite(manga.Link)
+}
+
+// ReleaseKey returns the link of MangaUpdates series and the title of the series
+// that are looked up by title.
+func (mangaUpdatesSource) ReleaseKey(manga Manga) string {
+	if mangaUpdatesLinkRegexp.MatchString(manga.Link) {
+		return normalizeURL(manga.Link)
+	}
+
+	return "title " + strings.ToLower(manga.Title)
+}
+
+func (m mangaUpdatesSource) Fetch(ctx context.Context, manga Manga) ScrapedSeries {
+	var series ScrapedSeries
+
+	seriesID := m.resolveSeriesID(ctx, manga)
+
+	if seriesID == 0 {
+		recordScrapeFailure(ScrapeFailure{
+			Link:   manga.Link,
+			Source: m.Name(),
+			Reason: "series not found",
+			At:     time.Now(),
+		})
+
+		return series
+	}
+
+	var releasesResponse MangaUpdatesReleasesResponse
+
+	if !mangaUpdatesRequest(ctx, "POST", "/v1/releases/search", map[string]interface{}{
+		"search":      strconv.FormatInt(seriesID, 10),
+		"search_type": "series",
+		"orderby":     "date",
+		"asc":         "desc",
+		"perpage":     25,
+	}, &releasesResponse) {
+		return series
+	}
+
+	for _, result := range releasesResponse.Results {
+		chapter := parseReleaseChapter(result.Record.Chapter)
+
+		if chapter > series.LatestChapter {
+			series.LatestChapter = chapter
+			series.LatestReleaseDate = result.Record.ReleaseDate
+
+			if len(result.Record.Groups) > 0 {
+				series.LatestReleaseGroup = result.Record.Groups[0].Name
+			}
+		}
+	}
+
+	if series.LatestChapter == 0 {
+		recordScrapeFailure(ScrapeFailure{
+			Link:   manga.Link,
+			Source: m.Name(),
+			Reason: "no chapter found",
+			At:     time.Now(),
+		})
+	} else {
+		series.Source = m.Name()
+		recordSourceSuccess(series.Source)
+	}
+
+	// Series details are only needed to fill in pages that were added by hand
+	if manga.Title == "" || manga.Art == "" {
+		var seriesResponse MangaUpdatesSeriesResponse
+
+		if mangaUpdatesRequest(ctx, "GET", "/v1/series/"+strconv.FormatInt(seriesID, 10), nil, &seriesResponse) {
+			series.Title = seriesResponse.Title
+			series.Cover = seriesResponse.Image.Url.Original
+			series.Status = normalizeStatus(seriesResponse.Status)
+
+			if seriesResponse.Completed {
+				series.Status = "Completed"
+			}
+
+			for _, associated := range seriesResponse.Associated {
+				series.AltTitles = append(series.AltTitles, associated.Title)
+			}
+
+			for _, author := range seriesResponse.Authors {
+				if !contains(series.Authors, author.Name) {
+					series.Authors = append(series.Authors, author.Name)
+				}
+			}
+		}
+	}
+
+	return series
+}
+
+// resolveSeriesID returns the MangaUpdates series ID of a page, remembering it in
+// the sync state so the title search only runs once.
+func (m mangaUpdatesSource) resolveSeriesID(ctx context.Context, manga Manga) int64 {
+	pageState := getPageState(manga.ID)
+
+	if pageState.MangaUpdatesID != 0 {
+		return pageState.MangaUpdatesID
+	}
+
+	var seriesID int64
+
+	if matches := mangaUpdatesLinkRegexp.FindStringSubmatch(manga.Link); matches != nil {
+		// Series links use the base 36 encoded series ID
+		seriesID, _ = strconv.ParseInt(matches[1], 36, 64)
+	} else {
+		var searchResponse MangaUpdatesSearchResponse
+
+		if !mangaUpdatesRequest(ctx, "POST", "/v1/series/search", map[string]interface{}{
+			"search":  manga.Title,
+			"perpage": 10,
+		}, &searchResponse) {
+			return 0
+		}
+
+		for _, result := range searchResponse.Results {
+			if strings.EqualFold(result.Record.Title, manga.Title) || strings.EqualFold(result.HitTitle, manga.Title) {
+				seriesID = result.Record.SeriesID
+				break
+			}
+		}
+	}
+
+	if seriesID != 0 {
+		pageState.MangaUpdatesID = seriesID
+		setPageState(manga.ID, pageState)
+	}
+
+	return seriesID
+}
+
+// parseReleaseChapter parses the chapter of a release, which may be a range such
+// as "10-12", in which case the last chapter is returned.
+func parseReleaseChapter(chapter string) float32 {
+	parts := strings.Split(chapter, "-")
+	number := releaseChapterRegexp.FindString(parts[len(parts)-1])
+
+	i, err := strconv.ParseFloat(number, 32)
+
+	if err != nil {
+		return 0
+	}
+
+	return float32(i)
+}
+
+func mangaUpdatesRequest(ctx context.Context, method string, path string, payload interface{}, response interface{}) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	var req *http.Request
+	if payload != nil {
+		body, _ := json.Marshal(payload)
+		req, _ = http.NewRequestWithContext(ctx, method, "https://api.mangaupdates.com"+path, bytes.NewBuffer(body))
+		req.Header.Add("Content-Type", "application/json")
+	} else {
+		req, _ = http.NewRequestWithContext(ctx, method, "https://api.mangaupdates.com"+path, nil)
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		slog.Error("Error calling mangaupdates", "source", "mangaupdates", "url", path, "err", err)
+
+		return false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		slog.Error("Error calling mangaupdates", "source", "mangaupdates", "url", path, "status_code", res.StatusCode)
+
+		return false
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		slog.Error("Error parsing response body for mangaupdates", "source", "mangaupdates", "url", path, "err", err)
+
+		return false
+	}
+
+	return true
+}
+
+func newMangaUpdatesSource() mangaUpdatesSource {
+	return mangaUpdatesSource{
+		fallback: getenv("MANGAUPDATES_FALLBACK") == "true",
+	}
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	syncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "manga_tracker_sync_duration_seconds",
+		Help:    "Duration of sync runs.",
+		Buckets: []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+	})
+	lastSuccessfulSync = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "manga_tracker_last_success_timestamp_seconds",
+		Help: "Unix time of the last sync run that finished without failed page writes.",
+	})
+	pageWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manga_tracker_pages_total",
+		Help: "Notion pages written, by result (created, updated or failed).",
+	}, []string{"result"})
+	sourceScrapes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manga_tracker_source_scrapes_total",
+		Help: "Scrapes and list fetches per source, by result (success or failure).",
+	}, []string{"source", "result"})
+	sourceLastRelease = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "manga_tracker_source_last_release_timestamp_seconds",
+		Help: "Unix time a source last reported a new release. A source that keeps succeeding without new releases may be returning stale values.",
+	}, []string{"source"})
+	apiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "manga_tracker_http_request_duration_seconds",
+		Help:    "Latency of outgoing HTTP requests, by API and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"api", "code"})
+	rateLimitHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manga_tracker_rate_limit_hits_total",
+		Help: "Responses with status 429 Too Many Requests, by API.",
+	}, []string{"api"})
+	scrapeCacheResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "manga_tracker_scrape_cache_requests_total",
+		Help: "Scraped page requests, by cache result (hit, revalidated or miss).",
+	}, []string{"result"})
+)
+
+// apiNames labels the hosts the tracker calls. Other hosts, such as the scraped
+// sites, are labelled by their host name.
+var apiNames = map[string]string{
+	"api.notion.com":       "notion",
+	"api.mangadex.org":     "mangadex",
+	"auth.mangadex.org":    "mangadex",
+	"uploads.mangadex.org": "mangadex",
+	"graphql.anilist.co":   "anilist",
+	"api.myanimelist.net":  "myanimelist",
+	"myanimelist.net":      "myanimelist",
+	"kitsu.io":             "kitsu",
+	"api.mangaupdates.com": "mangaupdates",
+	"discord.com":          "discord",
+	"api.telegram.org":     "telegram",
+}
+
+// metricsTransport records the latency and rate limit hits of outgoing requests.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+var apiTransport http.RoundTripper = metricsTransport{next: http.DefaultTransport}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	api := apiName(req.URL.Hostname())
+	start := time.Now()
+
+	res, err := t.next.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(res.StatusCode)
+
+		if res.StatusCode == http.StatusTooManyRequests {
+			rateLimitHits.WithLabelValues(api).Inc()
+		}
+	}
+
+	apiRequestDuration.WithLabelValues(api, code).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
+
+func apiName(host string) string {
+	if name, ok := apiNames[host]; ok {
+		return name
+	}
+
+	return strings.TrimPrefix(host, "www.")
+}
+
+func recordNewRelease(source string) {
+	sourceLastRelease.WithLabelValues(source).SetToCurrentTime()
+}
+
+func observeRun(duration time.Duration, pagesFailed int) {
+	syncDuration.Observe(duration.Seconds())
+
+	if pagesFailed == 0 {
+		lastSuccessfulSync.SetToCurrentTime()
+	}
+}
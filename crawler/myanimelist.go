@@ -0,0 +1,464 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type MyAnimeListToken struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresIn    int       `json:"expires_in"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type MyAnimeListNode struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	Synopsis    string `json:"synopsis"`
+	NumChapters int    `json:"num_chapters"`
+	NumVolumes  int    `json:"num_volumes"`
+	NumEpisodes int    `json:"num_episodes"`
+	StartDate   string `json:"start_date"`
+	UpdatedAt   string `json:"updated_at"`
+	MainPicture struct {
+		Large  string `json:"large"`
+		Medium string `json:"medium"`
+	} `json:"main_picture"`
+	AlternativeTitles struct {
+		Synonyms []string `json:"synonyms"`
+		En       string   `json:"en"`
+		Ja       string   `json:"ja"`
+	} `json:"alternative_titles"`
+	Genres []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	Authors []struct {
+		Node struct {
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+		} `json:"node"`
+	} `json:"authors"`
+}
+
+type MyAnimeListListResponse struct {
+	Data []struct {
+		Node       MyAnimeListNode `json:"node"`
+		ListStatus struct {
+			Status             string  `json:"status"`
+			Score              float32 `json:"score"`
+			NumChaptersRead    int     `json:"num_chapters_read"`
+			NumEpisodesWatched int     `json:"num_episodes_watched"`
+			UpdatedAt          string  `json:"updated_at"`
+		} `json:"list_status"`
+	} `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+const myAnimeListMangaFields = "list_status,num_chapters,num_volumes,status,synopsis,main_picture,alternative_titles,genres,start_date,updated_at,authors{first_name,last_name}"
+const myAnimeListAnimeFields = "list_status,num_episodes,status,synopsis,main_picture,alternative_titles,genres,start_date,updated_at"
+
+type myAnimeListIntegration struct {
+	clientID     string
+	clientSecret string
+	tokenFile    string
+	pushProgress bool
+}
+
+func newMyAnimeListIntegration() myAnimeListIntegration {
+	tokenFile := getenv("MAL_TOKEN_FILE")
+	if tokenFile == "" {
+		tokenFile = "mal-token.json"
+
+		// Every profile logs in to its own account
+		if name := profileName(); name != "" {
+			tokenFile = "mal-token-" + name + ".json"
+		}
+	}
+
+	return myAnimeListIntegration{
+		clientID:     getenv("MAL_CLIENT_ID"),
+		clientSecret: getenv("MAL_CLIENT_SECRET"),
+		tokenFile:    tokenFile,
+		pushProgress: getenv("MAL_PUSH_PROGRESS") == "true",
+	}
+}
+
+func (myAnimeListIntegration) Name() string {
+	return "MyAnimeList"
+}
+
+func (myAnimeListIntegration) LinkDomain() string {
+	return "myanimelist.net"
+}
+
+func (m myAnimeListIntegration) Enabled() bool {
+	if m.clientID == "" {
+		return false
+	}
+
+	_, err := os.Stat(m.tokenFile)
+
+	return err == nil
+}
+
+func (m myAnimeListIntegration) Fetch(ctx context.Context) []Manga {
+	var mangas []Manga
+
+	for _, list := range []struct {
+		path   string
+		fields string
+		anime  bool
+	}{
+		{"mangalist", myAnimeListMangaFields, false},
+		{"animelist", myAnimeListAnimeFields, true},
+	} {
+		next := fmt.Sprintf("https://api.myanimelist.net/v2/users/@me/%s?fields=%s&limit=1000&nsfw=true", list.path, url.QueryEscape(list.fields))
+
+		for next != "" {
+			var listResponse MyAnimeListListResponse
+
+			if !m.request(ctx, "GET", next, nil, &listResponse) {
+				break
+			}
+
+			for _, entry := range listResponse.Data {
+				manga := myAnimeListNodeToManga(entry.Node, list.anime)
+				manga.Rating = entry.ListStatus.Score
+
+				if list.anime {
+					manga.CurrentProgress = float32(entry.ListStatus.NumEpisodesWatched)
+				} else {
+					manga.CurrentProgress = float32(entry.ListStatus.NumChaptersRead)
+				}
+
+				manga.Status = []string{myAnimeListStatus(entry.ListStatus.Status, list.anime)}
+
+				mangas = append(mangas, manga)
+			}
+
+			next = listResponse.Paging.Next
+		}
+	}
+
+	return mangas
+}
+
+var myAnimeListLinkRegexp = regexp.MustCompile(`myanimelist\.net/(manga|anime)/([0-9]+)`)
+
+// PushProgress writes progress made in Notion back to the list on MyAnimeList.
+func (m myAnimeListIntegration) PushProgress(ctx context.Context, manga Manga, progress float32) bool {
+	if !m.pushProgress {
+		return false
+	}
+
+	matches := myAnimeListLinkRegexp.FindStringSubmatch(manga.Link)
+
+	if matches == nil {
+		return false
+	}
+
+	form := url.Values{}
+	if matches[1] == "anime" {
+		form.Set("num_watched_episodes", fmt.Sprintf("%v", int(progress)))
+	} else {
+		form.Set("num_chapters_read", fmt.Sprintf("%v", int(progress)))
+	}
+
+	slog.Info("Pushing progress to myanimelist", "source", "myanimelist", "url", manga.Link, "progress", progress)
+
+	return m.request(ctx, "PATCH", fmt.Sprintf("https://api.myanimelist.net/v2/%s/%s/my_list_status", matches[1], matches[2]), form, nil)
+}
+
+// request calls the MyAnimeList API, refreshing the stored access token when it
+// has expired.
+func (m myAnimeListIntegration) request(ctx context.Context, method string, endpoint string, form url.Values, response interface{}) bool {
+	token, ok := m.token(ctx)
+
+	if !ok {
+		return false
+	}
+
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	var req *http.Request
+	if form != nil {
+		req, _ = http.NewRequestWithContext(ctx, method, endpoint, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req, _ = http.NewRequestWithContext(ctx, method, endpoint, nil)
+	}
+	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		slog.Error("Error calling myanimelist", "source", "myanimelist", "url", endpoint, "err", err)
+
+		return false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		slog.Error("Error calling myanimelist", "source", "myanimelist", "url", endpoint, "status_code", res.StatusCode)
+
+		return false
+	}
+
+	if response == nil {
+		return true
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		slog.Error("Error parsing response body for myanimelist", "source", "myanimelist", "url", endpoint, "err", err)
+
+		return false
+	}
+
+	return true
+}
+
+func (m myAnimeListIntegration) token(ctx context.Context) (MyAnimeListToken, bool) {
+	var token MyAnimeListToken
+
+	body, err := ioutil.ReadFile(m.tokenFile)
+
+	if err != nil {
+		slog.Error("Error reading myanimelist token, run the mal-login command first", "source", "myanimelist", "err", err)
+
+		return token, false
+	}
+
+	if err := json.Unmarshal(body, &token); err != nil {
+		slog.Error("Error parsing myanimelist token", "source", "myanimelist", "err", err)
+
+		return token, false
+	}
+
+	if time.Now().Add(time.Minute).Before(token.ExpiresAt) {
+		return token, true
+	}
+
+	slog.Info("Refreshing myanimelist token", "source", "myanimelist")
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", token.RefreshToken)
+
+	return m.requestToken(ctx, form)
+}
+
+// requestToken calls the MyAnimeList token endpoint and stores the new token.
+func (m myAnimeListIntegration) requestToken(ctx context.Context, form url.Values) (MyAnimeListToken, bool) {
+	var token MyAnimeListToken
+
+	form.Set("client_id", m.clientID)
+	if m.clientSecret != "" {
+		form.Set("client_secret", m.clientSecret)
+	}
+
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://myanimelist.net/v1/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+
+	if err != nil {
+		slog.Error("Error requesting myanimelist token", "source", "myanimelist", "err", err)
+
+		return token, false
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		slog.Error("Error requesting myanimelist token", "source", "myanimelist", "status_code", res.StatusCode)
+
+		return token, false
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		slog.Error("Error parsing response body for myanimelist token", "source", "myanimelist", "err", err)
+
+		return token, false
+	}
+
+	token.ExpiresAt = time.Now().Add(time.Second * time.Duration(token.ExpiresIn))
+
+	body, _ := json.MarshalIndent(token, "", "  ")
+
+	if err := ioutil.WriteFile(m.tokenFile, body, 0600); err != nil {
+		slog.Error("Error writing myanimelist token", "source", "myanimelist", "err", err)
+	}
+
+	return token, true
+}
+
+// LoginMyAnimeList runs the OAuth2 PKCE authorization flow for MyAnimeList and
+// stores the resulting token in MAL_TOKEN_FILE. MyAnimeList only supports the
+// plain code challenge method, so the verifier doubles as the challenge. It logs
+// in the profile named by PROFILE.
+func LoginMyAnimeList(ctx context.Context) {
+	loadConfig()
+
+	m := newMyAnimeListIntegration()
+
+	if m.clientID == "" {
+		slog.Error("MAL_CLIENT_ID is not set")
+
+		return
+	}
+
+	verifier := make([]byte, 64)
+	if _, err := rand.Read(verifier); err != nil {
+		slog.Error("Error creating code verifier", "err", err)
+
+		return
+	}
+	codeVerifier := base64.RawURLEncoding.EncodeToString(verifier)
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", m.clientID)
+	query.Set("code_challenge", codeVerifier)
+	query.Set("code_challenge_method", "plain")
+
+	fmt.Printf("Open the following url, authorize the application and paste the code from the redirect url:\n\nhttps://myanimelist.net/v1/oauth2/authorize?%s\n\nCode: ", query.Encode())
+
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	if err != nil {
+		slog.Error("Error reading authorization code", "err", err)
+
+		return
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", strings.TrimSpace(code))
+	form.Set("code_verifier", codeVerifier)
+
+	if _, ok := m.requestToken(ctx, form); ok {
+		slog.Info("Stored myanimelist token", "path", m.tokenFile)
+	}
+}
+
+func myAnimeListNodeToManga(node MyAnimeListNode, anime bool) Manga {
+	manga := Manga{
+		Type:              "Manga",
+		Title:             node.Title,
+		Link:              fmt.Sprintf("https://myanimelist.net/manga/%v", node.ID),
+		SeenLatestRelease: false,
+		Art:               node.MainPicture.Large,
+		Description:       node.Synopsis,
+		AltTitles:         node.AlternativeTitles.Synonyms,
+		PublicationStatus: myAnimeListPublicationStatus(node.Status),
+		LastChapter:       float32(node.NumChapters),
+		LatestRelease:     float32(node.NumChapters),
+	}
+
+	if node.AlternativeTitles.En != "" {
+		manga.Title = node.AlternativeTitles.En
+		manga.AltTitles = append([]string{node.Title}, manga.AltTitles...)
+	}
+
+	if manga.Art == "" {
+		manga.Art = node.MainPicture.Medium
+	}
+
+	for _, genre := range node.Genres {
+		manga.Genres = append(manga.Genres, genre.Name)
+	}
+
+	for _, author := range node.Authors {
+		manga.Authors = append(manga.Authors, strings.TrimSpace(author.Node.FirstName+" "+author.Node.LastName))
+	}
+
+	if len(node.StartDate) >= 4 {
+		fmt.Sscanf(node.StartDate[:4], "%d", &manga.Year)
+	}
+
+	if node.NumVolumes != 0 {
+		manga.LastVolume = fmt.Sprintf("%v", node.NumVolumes)
+	}
+
+	if updatedAt, err := time.Parse(time.RFC3339, node.UpdatedAt); err == nil {
+		manga.LatestReleaseUpdatedAt = updatedAt.In(loc).Format("2006-01-02 15:04:05")
+	}
+
+	if anime {
+		manga.Type = "Anime"
+		manga.Link = fmt.Sprintf("https://myanimelist.net/anime/%v", node.ID)
+		manga.LastChapter = float32(node.NumEpisodes)
+
+		// MyAnimeList has no airing progress, so only finished series report their
+		// latest episode
+		if node.Status == "finished_airing" {
+			manga.LatestRelease = float32(node.NumEpisodes)
+		} else {
+			manga.LatestRelease = 0
+		}
+	}
+
+	return manga
+}
+
+func myAnimeListStatus(status string, anime bool) string {
+	switch status {
+	case "reading":
+		return Reading
+	case "watching":
+		return Watching
+	case "completed":
+		return Completed
+	case "on_hold":
+		return OnHold
+	case "dropped":
+		return Dropped
+	case "plan_to_watch":
+		return PlanningToWatch
+	default:
+		if anime {
+			return PlanningToWatch
+		}
+
+		return PlanningToRead
+	}
+}
+
+func myAnimeListPublicationStatus(status string) string {
+	switch status {
+	case "finished", "finished_airing":
+		return "Completed"
+	case "currently_publishing", "currently_airing":
+		return "Ongoing"
+	case "on_hiatus":
+		return "Hiatus"
+	case "discontinued":
+		return "Cancelled"
+	case "not_yet_published", "not_yet_aired":
+		return "Not Yet Released"
+	default:
+		return ""
+	}
+}
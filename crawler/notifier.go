@@ -0,0 +1,390 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ChapterBump describes a series whose latest release was bumped during a sync.
+type ChapterBump struct {
+	Title   string  `json:"title"`
+	Chapter float32 `json:"chapter"`
+	Link    string  `json:"link"`
+	Cover   string  `json:"cover,omitempty"`
+}
+
+// Notifier delivers chapter notifications to a single sink.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error
+}
+
+const defaultNotifyTemplate = "{{.Title}} chapter {{.Chapter}} is out: {{.Link}}"
+
+var notifiers []Notifier
+var notifyTemplate *template.Template
+var notifyDigest bool
+var pendingBumps []ChapterBump
+var pendingBumpsMutex sync.Mutex
+
+func loadNotifiers() {
+	notifiers = nil
+	pendingBumps = nil
+	notifyDigest = getenv("NOTIFY_DIGEST") == "true"
+
+	text := getenv("NOTIFY_TEMPLATE")
+	if text == "" {
+		text = defaultNotifyTemplate
+	}
+
+	var err error
+	notifyTemplate, err = template.New("notification").Parse(text)
+
+	if err != nil {
+		slog.Error("Error parsing NOTIFY_TEMPLATE, falling back to the default template", "err", err)
+
+		notifyTemplate = template.Must(template.New("notification").Parse(defaultNotifyTemplate))
+	}
+
+	if webhookURL := getenv("DISCORD_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, discordNotifier{webhookURL: webhookURL})
+	}
+
+	if botToken := getenv("TELEGRAM_BOT_TOKEN"); botToken != "" {
+		notifiers = append(notifiers, telegramNotifier{botToken: botToken, chatID: getenv("TELEGRAM_CHAT_ID")})
+	}
+
+	if topicURL := getenv("NTFY_URL"); topicURL != "" {
+		notifiers = append(notifiers, ntfyNotifier{topicURL: topicURL, token: getenv("NTFY_TOKEN")})
+	}
+
+	if serverURL := getenv("GOTIFY_URL"); serverURL != "" {
+		notifiers = append(notifiers, gotifyNotifier{serverURL: serverURL, token: getenv("GOTIFY_TOKEN")})
+	}
+
+	if host := getenv("SMTP_HOST"); host != "" {
+		notifiers = append(notifiers, emailNotifier{
+			host:     host,
+			port:     getenv("SMTP_PORT"),
+			username: getenv("SMTP_USERNAME"),
+			password: getenv("SMTP_PASSWORD"),
+			from:     getenv("SMTP_FROM"),
+			to:       splitList(getenv("SMTP_TO")),
+		})
+	}
+
+	if webhookURL := getenv("WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, webhookNotifier{webhookURL: webhookURL})
+	}
+}
+
+// notifyChapterBump sends a notification for a new chapter, or queues it until the
+// end of the sync when digest mode is enabled.
+func notifyChapterBump(ctx context.Context, manga Manga, chapter float32) {
+	if len(notifiers) == 0 || manga.Muted {
+		return
+	}
+
+	bump := ChapterBump{
+		Title:   manga.Title,
+		Chapter: chapter,
+		Link:    manga.Link,
+		Cover:   manga.Art,
+	}
+
+	if notifyDigest {
+		pendingBumpsMutex.Lock()
+		pendingBumps = append(pendingBumps, bump)
+		pendingBumpsMutex.Unlock()
+
+		return
+	}
+
+	sendNotification(ctx, fmt.Sprintf("New chapter for %s", bump.Title), []ChapterBump{bump})
+}
+
+// flushNotifications sends all queued chapter bumps as a single digest message.
+func flushNotifications(ctx context.Context) {
+	pendingBumpsMutex.Lock()
+	bumps := pendingBumps
+	pendingBumps = nil
+	pendingBumpsMutex.Unlock()
+
+	if len(bumps) == 0 {
+		return
+	}
+
+	if len(bumps) == 1 {
+		sendNotification(ctx, fmt.Sprintf("New chapter for %s", bumps[0].Title), bumps)
+	} else {
+		sendNotification(ctx, fmt.Sprintf("%d new chapters", len(bumps)), bumps)
+	}
+}
+
+func sendNotification(ctx context.Context, subject string, bumps []ChapterBump) {
+	// The chapters are already in Notion, so their notifications go out even when
+	// the run was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	var lines []string
+
+	for _, bump := range bumps {
+		var line bytes.Buffer
+
+		if err := notifyTemplate.Execute(&line, bump); err != nil {
+			slog.Error("Error rendering notification", "url", bump.Link, "err", err)
+			continue
+		}
+
+		lines = append(lines, line.String())
+	}
+
+	message := strings.Join(lines, "\n")
+
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, subject, message, bumps); err != nil {
+			slog.Error("Error sending notification", "notifier", notifier.Name(), "err", err)
+		}
+	}
+}
+
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	req.Header.Add("Content-Type", "application/json")
+
+	return sendRequest(req)
+}
+
+func sendRequest(req *http.Request) error {
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %v", res.StatusCode)
+	}
+
+	return nil
+}
+
+type discordNotifier struct {
+	webhookURL string
+}
+
+func (n discordNotifier) Name() string {
+	return "discord"
+}
+
+func (n discordNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	type thumbnail struct {
+		Url string `json:"url"`
+	}
+
+	type embed struct {
+		Title     string     `json:"title"`
+		Url       string     `json:"url"`
+		Thumbnail *thumbnail `json:"thumbnail,omitempty"`
+	}
+
+	var embeds []embed
+
+	// Discord accepts at most 10 embeds per message
+	for _, bump := range bumps {
+		if len(embeds) == 10 {
+			break
+		}
+
+		e := embed{
+			Title: fmt.Sprintf("%s - chapter %v", bump.Title, bump.Chapter),
+			Url:   bump.Link,
+		}
+
+		if bump.Cover != "" {
+			e.Thumbnail = &thumbnail{Url: bump.Cover}
+		}
+
+		embeds = append(embeds, e)
+	}
+
+	content := []rune(fmt.Sprintf("**%s**\n%s", subject, message))
+
+	// Discord rejects messages longer than 2000 characters
+	if len(content) > 2000 {
+		content = append(content[:1997], []rune("...")...)
+	}
+
+	return postJSON(ctx, n.webhookURL, map[string]interface{}{
+		"content": string(content),
+		"embeds":  embeds,
+	})
+}
+
+type telegramNotifier struct {
+	botToken string
+	chatID   string
+}
+
+func (n telegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (n telegramNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	text := subject + "\n\n" + message
+
+	if len(bumps) == 1 && bumps[0].Cover != "" {
+		return postJSON(ctx, fmt.Sprintf("https://api.telegram.org/bot%s/sendPhoto", n.botToken), map[string]interface{}{
+			"chat_id": n.chatID,
+			"photo":   bumps[0].Cover,
+			"caption": text,
+		})
+	}
+
+	return postJSON(ctx, fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.botToken), map[string]interface{}{
+		"chat_id": n.chatID,
+		"text":    text,
+	})
+}
+
+type ntfyNotifier struct {
+	topicURL string
+	token    string
+}
+
+func (n ntfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n ntfyNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	req, _ := http.NewRequestWithContext(ctx, "POST", n.topicURL, strings.NewReader(message))
+	req.Header.Add("Title", subject)
+
+	if n.token != "" {
+		req.Header.Add("Authorization", "Bearer "+n.token)
+	}
+
+	if len(bumps) == 1 {
+		req.Header.Add("Click", bumps[0].Link)
+
+		if bumps[0].Cover != "" {
+			req.Header.Add("Attach", bumps[0].Cover)
+		}
+	}
+
+	return sendRequest(req)
+}
+
+type gotifyNotifier struct {
+	serverURL string
+	token     string
+}
+
+func (n gotifyNotifier) Name() string {
+	return "gotify"
+}
+
+func (n gotifyNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	notification := map[string]interface{}{}
+
+	if len(bumps) == 1 {
+		notification["click"] = map[string]string{"url": bumps[0].Link}
+
+		if bumps[0].Cover != "" {
+			notification["bigImageUrl"] = bumps[0].Cover
+		}
+	}
+
+	return postJSON(ctx, fmt.Sprintf("%s/message?token=%s", strings.TrimSuffix(n.serverURL, "/"), url.QueryEscape(n.token)), map[string]interface{}{
+		"title":    subject,
+		"message":  message,
+		"priority": 5,
+		"extras": map[string]interface{}{
+			"client::notification": notification,
+		},
+	})
+}
+
+type emailNotifier struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (n emailNotifier) Name() string {
+	return "email"
+}
+
+func (n emailNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	return n.send(ctx, subject, "text/plain", message)
+}
+
+func (n emailNotifier) send(ctx context.Context, subject string, contentType string, body string) error {
+	port := n.port
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", headerValue(n.from))
+	fmt.Fprintf(&email, "To: %s\r\n", headerValue(strings.Join(n.to, ", ")))
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(subject)))
+	fmt.Fprintf(&email, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&email, "Content-Type: %s; charset=UTF-8\r\n\r\n", contentType)
+	email.WriteString(body)
+
+	return smtp.SendMail(n.host+":"+port, auth, n.from, n.to, email.Bytes())
+}
+
+// headerValue removes line breaks from a mail header value, so a series title
+// cannot add headers of its own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+}
+
+type webhookNotifier struct {
+	webhookURL string
+}
+
+func (n webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n webhookNotifier) Notify(ctx context.Context, subject string, message string, bumps []ChapterBump) error {
+	return postJSON(ctx, n.webhookURL, map[string]interface{}{
+		"title":    subject,
+		"message":  message,
+		"chapters": bumps,
+	})
+}
@@ -2,12 +2,14 @@ package crawler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,80 +26,198 @@ type Manga struct {
 	LatestReleaseUpdatedAt string
 	Rating                 float32
 	Art                    string
-}
-
-type Type struct {
-	Select Select `json:"select"`
+	Icon                   string
+	Description            string
+	AltTitles              []string
+	Authors                []string
+	Genres                 []string
+	PublicationStatus      string
+	Demographic            string
+	Year                   int
+	LastVolume             string
+	LastChapter            float32
+	Muted                  bool
+	ChaptersBehind         float32
+	UnreadSince            string
 }
 
 type Select struct {
 	Name string `json:"name"`
 }
 
-type CurrentProgress struct {
-	Number float32 `json:"number"`
+type MultiSelect struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
 }
 
-type Rating struct {
-	Number float32 `json:"number"`
+type Date struct {
+	Start string `json:"start"`
 }
 
-type Link struct {
-	Url string `json:"url"`
+type Text struct {
+	Content string `json:"content"`
 }
 
-type MultiSelect struct {
-	Name  string `json:"name"`
-	Color string `json:"color,omitempty"`
+type Titles struct {
+	Text Text `json:"text"`
 }
 
-type Status struct {
-	MultiSelect []MultiSelect `json:"multi_select"`
+type Title struct {
+	Title []Titles `json:"title"`
 }
 
-type Date struct {
-	Start string `json:"start"`
+type RichText struct {
+	RichText []Titles `json:"rich_text"`
+}
+
+type SelectProperty struct {
+	Select Select `json:"select"`
 }
 
-type LatestReleaseUpdatedAt struct {
-	Date Date `json:"date"`
+type MultiSelectProperty struct {
+	MultiSelect []MultiSelect `json:"multi_select"`
 }
 
-type LatestRelease struct {
+type NumberProperty struct {
 	Number float32 `json:"number"`
 }
 
-type SeenLatestRelease struct {
+type DateProperty struct {
+	Date *Date `json:"date"`
+}
+
+type StatusProperty struct {
+	Status Select `json:"status"`
+}
+
+type CheckboxProperty struct {
 	Checkbox bool `json:"checkbox"`
 }
 
-type ReleaseSchedule struct {
-	MultiSelect []MultiSelect `json:"multi_select"`
+type UrlProperty struct {
+	Url string `json:"url"`
 }
 
-type Text struct {
-	Content string `json:"content"`
+// NotionProperties holds every property of a retrieved page by name. Fields are
+// read through the schema, see Schema.
+type NotionProperties map[string]json.RawMessage
+
+// selectValue returns the option name of a select property, or an empty string
+// when the page has no such property or no option selected.
+func (p NotionProperties) selectValue(name string) string {
+	var property struct {
+		Select *Select `json:"select"`
+	}
+
+	if err := json.Unmarshal(p[name], &property); err != nil || property.Select == nil {
+		return ""
+	}
+
+	return property.Select.Name
 }
 
-type Titles struct {
-	Text Text `json:"text"`
+// statusValue returns the option name of a status property.
+func (p NotionProperties) statusValue(name string) string {
+	var property struct {
+		Status *Select `json:"status"`
+	}
+
+	if err := json.Unmarshal(p[name], &property); err != nil || property.Status == nil {
+		return ""
+	}
+
+	return property.Status.Name
 }
 
-type Title struct {
-	Title []Titles `json:"title"`
+// checkboxValue returns whether a checkbox property is checked.
+func (p NotionProperties) checkboxValue(name string) bool {
+	var property CheckboxProperty
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return false
+	}
+
+	return property.Checkbox
 }
 
-type NotionProperties struct {
-	Type                   Type                   `json:"Type"`
-	CurrentProgress        CurrentProgress        `json:"Current Progress"`
-	Rating                 Rating                 `json:"Rating,omitempty"`
-	Link                   Link                   `json:"Link"`
-	Status                 Status                 `json:"Status"`
-	LatestReleaseUpdatedAt LatestReleaseUpdatedAt `json:"Latest Release Updated At"`
-	LatestRelease          LatestRelease          `json:"Latest Release"`
-	SeenLatestRelease      SeenLatestRelease      `json:"Seen Latest Release"`
-	ReleaseSchedule        *ReleaseSchedule       `json:"Release Schedule,omitempty"`
-	Title                  Title                  `json:"Title"`
+func (p NotionProperties) numberValue(name string) float32 {
+	var property NumberProperty
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return 0
+	}
+
+	return property.Number
+}
+
+// dateValue returns the start of a date property, or an empty string when no date
+// is set.
+func (p NotionProperties) dateValue(name string) string {
+	var property DateProperty
+
+	if err := json.Unmarshal(p[name], &property); err != nil || property.Date == nil {
+		return ""
+	}
+
+	return property.Date.Start
+}
+
+// richTextValue returns the plain text of a rich text property.
+func (p NotionProperties) richTextValue(name string) string {
+	var property RichText
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return ""
+	}
+
+	return plainText(property.RichText)
+}
+
+// titleValue returns the plain text of a title property.
+func (p NotionProperties) titleValue(name string) string {
+	var property Title
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return ""
+	}
+
+	return plainText(property.Title)
+}
+
+func (p NotionProperties) urlValue(name string) string {
+	var property UrlProperty
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return ""
+	}
+
+	return property.Url
+}
+
+// multiSelectValue returns the option names of a multi-select property.
+func (p NotionProperties) multiSelectValue(name string) []string {
+	var property MultiSelectProperty
+
+	if err := json.Unmarshal(p[name], &property); err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, option := range property.MultiSelect {
+		names = append(names, option.Name)
+	}
+
+	return names
+}
+
+func plainText(titles []Titles) string {
+	var text strings.Builder
+
+	for _, title := range titles {
+		text.WriteString(title.Text.Content)
+	}
+
+	return text.String()
 }
 
 type NotionPagesResponseResults struct {
@@ -111,48 +231,90 @@ type NotionPagesResponseResults struct {
 	} `json:"parent"`
 	Archived   bool             `json:"archived"`
 	Url        string           `json:"url"`
+	Cover      *Image           `json:"cover"`
+	Icon       *Image           `json:"icon"`
 	Properties NotionProperties `json:"properties"`
 }
 
 type NotionPagesResponse struct {
-	Object     string                       `json:"object"`
-	Results    []NotionPagesResponseResults `json:"results"`
-	HasMore    bool                         `json:"has_more"`
-	NextCursor string                       `json:"next_cursor"`
-}
-
-type NotionUpdateBody struct {
-	Properties struct {
-		LatestReleaseUpdatedAt LatestReleaseUpdatedAt `json:"Latest Release Updated At"`
-		LatestRelease          LatestRelease          `json:"Latest Release"`
-		SeenLatestRelease      SeenLatestRelease      `json:"Seen Latest Release"`
-		Status                 *Status                `json:"Status,omitempty"`
-	} `json:"properties"`
+	Object string `json:"object"`
+	// Results are decoded one by one, so a single malformed page is skipped
+	// instead of failing the whole query.
+	Results    []json.RawMessage `json:"results"`
+	HasMore    bool              `json:"has_more"`
+	NextCursor string            `json:"next_cursor"`
 }
 
 type Parent struct {
-	DatabaseID string `json:"database_id"`
+	DatabaseID string `json:"database_id,omitempty"`
+	PageID     string `json:"page_id,omitempty"`
 }
 
 type External struct {
 	Url string `json:"url"`
 }
 
+// Image is a cover, icon or image block. Pages read from Notion can also hold an
+// uploaded file or, for icons, an emoji.
 type Image struct {
-	Type     string   `json:"type"`
-	External External `json:"external"`
+	Type     string    `json:"type"`
+	External External  `json:"external"`
+	File     *External `json:"file,omitempty"`
+	Emoji    string    `json:"emoji,omitempty"`
+}
+
+// imageValue returns what a cover or icon holds: the URL of an external or
+// uploaded file, or the emoji. Only external URLs can equal what the tracker
+// wrote, so uploaded covers and emoji icons count as set by the user.
+func imageValue(image *Image) string {
+	if image == nil {
+		return ""
+	}
+
+	switch image.Type {
+	case "external":
+		return image.External.Url
+	case "file":
+		if image.File != nil && image.File.Url != "" {
+			return image.File.Url
+		}
+	case "emoji":
+		if image.Emoji != "" {
+			return image.Emoji
+		}
+	}
+
+	return image.Type
+}
+
+// Paragraph is the text of a paragraph, heading or list item block. Notion
+// versions before 2022-02-22 call it text, later ones rich_text, see blockText.
+type Paragraph struct {
+	Text     []Titles `json:"text,omitempty"`
+	RichText []Titles `json:"rich_text,omitempty"`
 }
 
 type Children struct {
-	Object string `json:"object"`
-	Type   string `json:"type"`
-	Image  Image  `json:"image"`
+	Object           string     `json:"object"`
+	Type             string     `json:"type"`
+	Image            *Image     `json:"image,omitempty"`
+	Paragraph        *Paragraph `json:"paragraph,omitempty"`
+	Heading2         *Paragraph `json:"heading_2,omitempty"`
+	BulletedListItem *Paragraph `json:"bulleted_list_item,omitempty"`
+}
+
+type NotionPatchBody struct {
+	Properties map[string]interface{} `json:"properties,omitempty"`
+	Cover      *Image                 `json:"cover,omitempty"`
+	Icon       *Image                 `json:"icon,omitempty"`
 }
 
 type NotionCreateBody struct {
-	Parent     Parent           `json:"parent"`
-	Properties NotionProperties `json:"properties"`
-	Children   []Children       `json:"children"`
+	Parent     Parent                 `json:"parent"`
+	Cover      *Image                 `json:"cover,omitempty"`
+	Icon       *Image                 `json:"icon,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+	Children   []Children             `json:"children,omitempty"`
 }
 
 const (
@@ -166,35 +328,46 @@ const (
 	OnHold          string = "On Hold"
 )
 
+const defaultNotionVersion = "2021-08-16"
+
+// Notion versions from 2025-09-03 on query databases through data sources,
+// which are not supported. Those fall back to the last version before them.
+const dataSourcesNotionVersion = "2025-09-03"
+const lastDatabaseNotionVersion = "2022-06-28"
+
+// notionAPI is the base URL of the Notion API, replaced by the tests.
+var notionAPI = "https://api.notion.com/v1"
+
 var notionSecret string
+var notionVersion string
 var notionDatabaseId string
-
-func getColorForStatus(status string) string {
-	switch status {
-	case Dropped:
-		return "brown"
-	case DoneAiring:
-		return "green"
-	case Completed:
-		return "pink"
-	case PlanningToRead:
-		return "purple"
-	case PlanningToWatch:
-		return "purple"
-	case Watching:
-		return "red"
-	case Reading:
-		return "red"
-	case OnHold:
-		return "blue"
-	default:
-		return ""
-	}
-}
+var refreshMetadata bool
+var coverAsIcon bool
 
 var loc *time.Location
+var syncTimeout time.Duration
+var configOnce sync.Once
+
+// loadConfig reads the profiles once per process and activates the one named by
+// PROFILE, or the first one. Runs, digests and the HTTP server switch profiles
+// through withProfile, so they never race on the package globals.
+func loadConfig() {
+	configOnce.Do(func() {
+		loadProfiles()
+		loadScrapeCache()
+		loadScraperConfig()
+
+		profile, ok := findProfile(os.Getenv("PROFILE"))
+		if !ok {
+			slog.Warn("Unknown PROFILE, using the first profile", "profile", os.Getenv("PROFILE"))
+			profile = profiles[0]
+		}
 
-func Sync() {
+		withProfile(profile, func() {})
+	})
+}
+
+func readConfig() {
 	loc, _ = time.LoadLocation("Europe/Amsterdam")
 	// err := godotenv.Load(".env")
 
@@ -202,192 +375,702 @@ func Sync() {
 	// 	log.Printf("Error loading .env file, err: %s \n", err)
 	// }
 
-	notionSecret = os.Getenv("NOTION_SECRET")
-	notionDatabaseId = os.Getenv("NOTION_DATABASE_ID")
+	notionSecret = getenv("NOTION_SECRET")
+	notionDatabaseId = getenv("NOTION_DATABASE_ID")
+
+	notionVersion = getenv("NOTION_VERSION")
+	if notionVersion == "" {
+		notionVersion = defaultNotionVersion
+	} else if notionVersion >= dataSourcesNotionVersion {
+		slog.Warn("NOTION_VERSION uses data sources, which are not supported", "version", notionVersion, "fallback", lastDatabaseNotionVersion)
+		notionVersion = lastDatabaseNotionVersion
+	}
 
-	elapsedTime := time.Since(time.Now())
-	log.Println("Starting sync \n")
+	loadSchema()
+	loadState()
 
-	syncMangaDexWithNotion()
-	syncNotionPagesWithIntegrations()
+	syncTimeout = 0
+	if timeout := getenv("SYNC_TIMEOUT"); timeout != "" {
+		var err error
+
+		if syncTimeout, err = time.ParseDuration(timeout); err != nil {
+			slog.Error("Error parsing SYNC_TIMEOUT", "err", err)
+		}
+	}
 
-	log.Printf("Sync completed, time elapsed: %s \n", elapsedTime)
+	refreshMetadata = getenv("REFRESH_METADATA") == "true"
+	coverAsIcon = getenv("NOTION_COVER_AS_ICON") == "true"
+	loadNotifiers()
 }
 
-func updateNotionPage(pageID string, latestChapter float32, latestReleaseUpdatedAt string, status string) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
+// Sync runs a full sync. It is skipped when another sync is still running. Once
+// ctx is done no new work is started. SYNC_TIMEOUT limits every profile on its
+// own, so a slow profile doesn't use up the time of the ones after it.
+func Sync(ctx context.Context) {
+	if !beginSync() {
+		slog.Warn("Sync already running, skipping")
+		return
 	}
+	defer endSync()
 
-	notionUpdateBody := NotionUpdateBody{}
-	notionUpdateBody.Properties.LatestRelease.Number = latestChapter
-	notionUpdateBody.Properties.SeenLatestRelease.Checkbox = false
+	runSync(ctx)
+}
 
-	if latestReleaseUpdatedAt != "" {
-		notionUpdateBody.Properties.LatestReleaseUpdatedAt.Date.Start = latestReleaseUpdatedAt
-	} else {
-		notionUpdateBody.Properties.LatestReleaseUpdatedAt.Date.Start = time.Now().In(loc).Format("2006-01-02 15:04:05")
+func runSync(ctx context.Context) {
+	loadConfig()
+	beginRun()
+	defer setRunID("")
+
+	slog.Info("Starting sync")
+
+	resetScrapeResults()
+
+	// Profiles sync one after the other, a failing profile doesn't stop the rest
+	for _, profile := range profiles {
+		if ctx.Err() != nil {
+			break
+		}
+
+		withProfile(profile, func() {
+			defer recoverPanic("Recovered from panic while syncing profile")
+
+			profileCtx := ctx
+			if syncTimeout > 0 {
+				var cancel context.CancelFunc
+				profileCtx, cancel = context.WithTimeout(ctx, syncTimeout)
+				defer cancel()
+			}
+
+			syncProfile(profileCtx)
+
+			if err := profileCtx.Err(); err != nil && ctx.Err() == nil {
+				slog.Warn("Profile sync stopped early", "err", err)
+			}
+		})
+	}
+
+	if err := ctx.Err(); err != nil {
+		slog.Warn("Sync stopped early", "err", err)
+	}
+
+	slog.Info("Sync completed", "elapsed", endRun().String())
+}
+
+// syncProfile syncs the lists and Notion database of the active profile.
+func syncProfile(ctx context.Context) {
+	if name := profileName(); name != "" {
+		slog.Info("Syncing profile")
+	}
+
+	// Background writes of a failed profile still finish before the next one
+	// is activated
+	defer pendingWrites.Wait()
+
+	detectSchemaTypes(ctx)
+
+	for _, integration := range integrations() {
+		if integration.Enabled() && ctx.Err() == nil {
+			syncIntegrationWithNotion(ctx, integration)
+		}
+	}
+
+	syncNotionPagesWithIntegrations(ctx)
+
+	pendingWrites.Wait()
+	syncBacklog(ctx)
+	flushNotifications(ctx)
+	writeCalendarFile(ctx)
+}
+
+var pendingWrites sync.WaitGroup
+
+var errNotionQuery = errors.New("error retrieving notion database pages")
+
+// goWrite runs a Notion write in the background. Sync waits for all of them to
+// finish before it completes.
+func goWrite(write func()) {
+	pendingWrites.Add(1)
+
+	go func() {
+		defer pendingWrites.Done()
+		defer recoverPanic("Recovered from panic in notion write")
+
+		write()
+	}()
+}
+
+// releaseChapter records a new latest release on the page of manga and notifies
+// about it.
+func releaseChapter(ctx context.Context, manga Manga, latestChapter float32, latestReleaseUpdatedAt string, status string) {
+	if !updateNotionPage(ctx, manga, latestChapter, latestReleaseUpdatedAt, status) {
+		return
 	}
 
+	recordRelease(manga.ID, Release{
+		Title:           manga.Title,
+		Link:            manga.Link,
+		Chapter:         latestChapter,
+		PreviousChapter: manga.LatestRelease,
+		At:              time.Now(),
+	})
+
+	notifyChapterBump(ctx, manga, latestChapter)
+}
+
+func updateNotionPage(ctx context.Context, manga Manga, latestChapter float32, latestReleaseUpdatedAt string, status string) bool {
+	notionUpdateBody := NotionPatchBody{
+		Properties: backlogProperties(manga, latestChapter),
+	}
+	setProperty(notionUpdateBody.Properties, fieldLatestRelease, latestChapter)
+	setProperty(notionUpdateBody.Properties, fieldSeenLatestRelease, manga.CurrentProgress >= latestChapter)
+
+	if latestReleaseUpdatedAt == "" {
+		latestReleaseUpdatedAt = time.Now().In(loc).Format("2006-01-02 15:04:05")
+	}
+	setProperty(notionUpdateBody.Properties, fieldLatestReleaseUpdatedAt, latestReleaseUpdatedAt)
+
 	if status != "" {
-		multiselect := make([]MultiSelect, 1)
-		multiselect[0].Color = getColorForStatus(status)
-		multiselect[0].Name = status
+		setProperty(notionUpdateBody.Properties, fieldStatus, []string{status})
+	}
+
+	return patchNotionPage(ctx, manga.ID, notionUpdateBody)
+}
+
+// backlogProperties returns the configured backlog properties of manga once its
+// latest release is latestChapter. Unread Since is set when the first unread
+// chapter comes out and cleared once the series has been caught up with.
+func backlogProperties(manga Manga, latestChapter float32) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	behind := latestChapter - manga.CurrentProgress
+	if behind < 0 {
+		behind = 0
+	}
+
+	setProperty(properties, fieldChaptersBehind, behind)
+
+	if behind == 0 {
+		setProperty(properties, fieldUnreadSince, "")
+	} else if manga.UnreadSince == "" {
+		setProperty(properties, fieldUnreadSince, time.Now().In(loc).Format("2006-01-02 15:04:05"))
+	}
+
+	return properties
+}
+
+// syncBacklog keeps Seen Latest Release and the backlog properties in line with
+// the reading progress of every page, so marking chapters as read in Notion is
+// reflected without waiting for the next release.
+func syncBacklog(ctx context.Context) {
+	mangas, ok := getAllNotionPages(ctx)
+	if !ok {
+		return
+	}
+
+	for _, manga := range mangas {
+		behind := manga.LatestRelease - manga.CurrentProgress
+		if behind < 0 {
+			behind = 0
+		}
 
-		notionUpdateBody.Properties.Status = &Status{
-			MultiSelect: multiselect,
+		seen := behind == 0
+		outdated := seen != manga.SeenLatestRelease ||
+			(getSchema().has(fieldChaptersBehind) && behind != manga.ChaptersBehind) ||
+			(getSchema().has(fieldUnreadSince) && seen != (manga.UnreadSince == ""))
+
+		if !outdated {
+			continue
+		}
+
+		slog.Info("Updating backlog", "page_id", manga.ID, "url", manga.Link)
+
+		notionUpdateBody := NotionPatchBody{
+			Properties: backlogProperties(manga, manga.LatestRelease),
 		}
+		setProperty(notionUpdateBody.Properties, fieldSeenLatestRelease, seen)
+
+		patchNotionPage(ctx, manga.ID, notionUpdateBody)
+	}
+}
+
+func updateProgress(ctx context.Context, pageID string, progress float32) bool {
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
+	}
+	setProperty(notionPatchBody.Properties, fieldCurrentProgress, progress)
+
+	return patchNotionPage(ctx, pageID, notionPatchBody)
+}
+
+func updateRating(ctx context.Context, pageID string, rating float32) bool {
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
+	}
+	setProperty(notionPatchBody.Properties, fieldRating, rating)
+
+	return patchNotionPage(ctx, pageID, notionPatchBody)
+}
+
+// updateStatus moves a page to status.
+func updateStatus(ctx context.Context, pageID string, status string) bool {
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
 	}
+	setProperty(notionPatchBody.Properties, fieldStatus, []string{status})
 
-	body, _ := json.Marshal(notionUpdateBody)
+	return patchNotionPage(ctx, pageID, notionPatchBody)
+}
+
+func patchNotionPage(ctx context.Context, pageID string, notionPatchBody interface{}) bool {
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
 
-	req, _ := http.NewRequest("PATCH", "https://api.notion.com/v1/pages/"+pageID, bytes.NewBuffer(body))
+	body, _ := json.Marshal(notionPatchBody)
+
+	// Writes are not cancelled with the run so a page is never left half updated
+	req, _ := http.NewRequestWithContext(context.WithoutCancel(ctx), "PATCH", notionAPI+"/pages/"+pageID, bytes.NewBuffer(body))
 	req.Header.Add("Authorization", "Bearer "+notionSecret)
-	req.Header.Add("Notion-Version", "2021-08-16")
+	req.Header.Add("Notion-Version", notionVersion)
 	req.Header.Add("Content-Type", "application/json")
 	res, err := client.Do(req)
 
 	if err != nil || res.StatusCode != 200 {
-		log.Printf("Error updating notion page, pageID: %s err: %s , status code: %v \n", pageID, err, res.StatusCode)
+		slog.Error("Error updating notion page", "page_id", pageID, "err", err, "status_code", statusCode(res), "message", errorMessage(res))
+		closeResponse(res)
+		recordPageWrite(false, false)
+
+		return false
 	}
 	defer res.Body.Close()
+
+	recordPageWrite(false, true)
+
+	return true
 }
 
-func createNotionPage(manga Manga) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
+// refreshNotionPage brings the cover, title and publication status of an existing
+// page in line with the integration, skipping fields edited by hand in Notion.
+func refreshNotionPage(ctx context.Context, notionManga Manga, manga Manga) {
+	pageState := getPageState(notionManga.ID)
+	newState := pageState
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
 	}
 
-	statusMultiSelect := make([]MultiSelect, len(manga.Status))
+	if manga.Title != "" && manga.Title != notionManga.Title && canOverwrite(notionManga.Title, pageState.Title) {
+		setProperty(notionPatchBody.Properties, fieldTitle, manga.Title)
+	}
+	if manga.Title == notionManga.Title || notionPatchBody.Properties[getSchema().name(fieldTitle)] != nil {
+		newState.Title = manga.Title
+	}
+
+	if getSchema().has(fieldPublicationStatus) && manga.PublicationStatus != "" {
+		if manga.PublicationStatus != notionManga.PublicationStatus && canOverwrite(notionManga.PublicationStatus, pageState.PublicationStatus) {
+			setProperty(notionPatchBody.Properties, fieldPublicationStatus, manga.PublicationStatus)
+		}
+		if manga.PublicationStatus == notionManga.PublicationStatus || notionPatchBody.Properties[getSchema().name(fieldPublicationStatus)] != nil {
+			newState.PublicationStatus = manga.PublicationStatus
+		}
+	}
+
+	if manga.Art != "" {
+		if manga.Art != notionManga.Art && canOverwrite(notionManga.Art, pageState.Cover) {
+			notionPatchBody.Cover = externalFile(manga.Art)
+		}
+		if manga.Art == notionManga.Art || notionPatchBody.Cover != nil {
+			newState.Cover = manga.Art
+		}
+
+		if coverAsIcon {
+			if manga.Art != notionManga.Icon && canOverwrite(notionManga.Icon, pageState.Icon) {
+				notionPatchBody.Icon = externalFile(manga.Art)
+			}
+			if manga.Art == notionManga.Icon || notionPatchBody.Icon != nil {
+				newState.Icon = manga.Art
+			}
+		}
+	}
+
+	if len(notionPatchBody.Properties) > 0 || notionPatchBody.Cover != nil || notionPatchBody.Icon != nil {
+		slog.Info("Refreshing metadata", "page_id", notionManga.ID, "url", manga.Link)
+
+		if !patchNotionPage(ctx, notionManga.ID, notionPatchBody) {
+			return
+		}
+	}
+
+	if newState != pageState {
+		setPageState(notionManga.ID, newState)
+	}
+}
+
+// isSeriesFinished reports whether a series has ended and its final chapter has
+// been released.
+func isSeriesFinished(manga Manga) bool {
+	return manga.PublicationStatus == "Completed" && manga.LastChapter != 0 && manga.LatestRelease >= manga.LastChapter
+}
+
+// markFinishedSeries flags the publication status of a finished series and moves
+// the page to Completed once its progress has reached the final chapter.
+func markFinishedSeries(ctx context.Context, notionManga Manga, manga Manga) {
+	if !isSeriesFinished(manga) {
+		return
+	}
+
+	pageState := getPageState(notionManga.ID)
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
+	}
+
+	if getSchema().has(fieldPublicationStatus) && notionManga.PublicationStatus != manga.PublicationStatus && canOverwrite(notionManga.PublicationStatus, pageState.PublicationStatus) {
+		setProperty(notionPatchBody.Properties, fieldPublicationStatus, manga.PublicationStatus)
+	}
+
+	if notionManga.CurrentProgress >= manga.LastChapter && !contains(notionManga.Status, Completed) {
+		setProperty(notionPatchBody.Properties, fieldStatus, []string{Completed})
+	}
+
+	if len(notionPatchBody.Properties) == 0 {
+		return
+	}
+
+	slog.Info("Marking series as finished", "page_id", notionManga.ID, "url", manga.Link)
+
+	if patchNotionPage(ctx, notionManga.ID, notionPatchBody) && notionPatchBody.Properties[getSchema().name(fieldPublicationStatus)] != nil {
+		pageState.PublicationStatus = manga.PublicationStatus
+		setPageState(notionManga.ID, pageState)
+	}
+}
+
+// fillNotionPage completes a page that was added by hand with the details scraped
+// from its link. Only properties that are still empty are filled in.
+func fillNotionPage(ctx context.Context, manga Manga, series ScrapedSeries) {
+	pageState := getPageState(manga.ID)
+	newState := pageState
+	notionPatchBody := NotionPatchBody{
+		Properties: make(map[string]interface{}),
+	}
+
+	if manga.Title == "" && series.Title != "" {
+		setProperty(notionPatchBody.Properties, fieldTitle, series.Title)
+		newState.Title = series.Title
+	}
+
+	if manga.Type == "" {
+		setProperty(notionPatchBody.Properties, fieldType, "Manga")
+	}
+
+	if len(manga.AltTitles) == 0 && len(series.AltTitles) > 0 {
+		setProperty(notionPatchBody.Properties, fieldAltTitles, strings.Join(series.AltTitles, "; "))
+	}
+
+	if len(manga.Authors) == 0 && len(series.Authors) > 0 {
+		setProperty(notionPatchBody.Properties, fieldAuthor, series.Authors)
+	}
+
+	if getSchema().has(fieldPublicationStatus) && manga.PublicationStatus == "" && series.Status != "" {
+		setProperty(notionPatchBody.Properties, fieldPublicationStatus, series.Status)
+		newState.PublicationStatus = series.Status
+	}
+
+	// Uploaded covers and emoji icons are not empty, see imageValue
+	fillCover := manga.Art == ""
+	fillIcon := coverAsIcon && manga.Icon == ""
+
+	if (fillCover || fillIcon) && series.Cover != "" && isImage(ctx, series.Cover) {
+		if fillCover {
+			notionPatchBody.Cover = externalFile(series.Cover)
+			newState.Cover = series.Cover
+		}
+
+		if fillIcon {
+			notionPatchBody.Icon = externalFile(series.Cover)
+			newState.Icon = series.Cover
+		}
+	}
 
-	for key, _ := range manga.Status {
-		statusMultiSelect[key].Name = manga.Status[key]
-		statusMultiSelect[key].Color = getColorForStatus(manga.Status[key])
+	if len(notionPatchBody.Properties) == 0 && notionPatchBody.Cover == nil && notionPatchBody.Icon == nil {
+		return
 	}
 
-	titles := make([]Titles, 1)
-	titles[0].Text.Content = manga.Title
+	slog.Info("Filling in details", "page_id", manga.ID, "url", manga.Link)
 
+	if patchNotionPage(ctx, manga.ID, notionPatchBody) && newState != pageState {
+		setPageState(manga.ID, newState)
+	}
+}
+
+func externalFile(url string) *Image {
+	return &Image{
+		Type: "external",
+		External: External{
+			Url: url,
+		},
+	}
+}
+
+func createNotionPage(ctx context.Context, manga Manga) {
 	notionCreateBody := &NotionCreateBody{
 		Parent: Parent{
 			DatabaseID: notionDatabaseId,
 		},
-		Properties: NotionProperties{
-			Type: Type{
-				Select: Select{
-					Name: manga.Type,
-				},
-			},
-			CurrentProgress: CurrentProgress{
-				Number: manga.CurrentProgress,
-			},
-			Link: Link{
-				Url: manga.Link,
-			},
-			Status: Status{
-				MultiSelect: statusMultiSelect,
-			},
-			LatestReleaseUpdatedAt: LatestReleaseUpdatedAt{
-				Date: Date{
-					Start: manga.LatestReleaseUpdatedAt,
-				},
-			},
-			LatestRelease: LatestRelease{
-				Number: manga.LatestRelease,
-			},
-			SeenLatestRelease: SeenLatestRelease{
-				Checkbox: manga.SeenLatestRelease,
-			},
-			Title: Title{
-				Title: titles,
-			},
-		},
+		Properties: metadataPropertiesForManga(manga),
 	}
 
-	notionCreateBody.Children = make([]Children, 1)
-	notionCreateBody.Children[0] = Children{
-		Object: "block",
-		Type:   "image",
-		Image: Image{
-			Type: "external",
-			External: External{
-				Url: manga.Art,
-			},
-		},
-	}
+	setProperty(notionCreateBody.Properties, fieldTitle, manga.Title)
+	setProperty(notionCreateBody.Properties, fieldType, manga.Type)
+	setProperty(notionCreateBody.Properties, fieldLink, manga.Link)
+	setProperty(notionCreateBody.Properties, fieldStatus, manga.Status)
+	setProperty(notionCreateBody.Properties, fieldCurrentProgress, manga.CurrentProgress)
+	setProperty(notionCreateBody.Properties, fieldLatestRelease, manga.LatestRelease)
+	setProperty(notionCreateBody.Properties, fieldLatestReleaseUpdatedAt, manga.LatestReleaseUpdatedAt)
+	setProperty(notionCreateBody.Properties, fieldSeenLatestRelease, manga.SeenLatestRelease)
 
 	if manga.ReleaseSchedule != "" {
-		releaseScheduleMultiSelect := make([]MultiSelect, 1)
-		releaseScheduleMultiSelect[0].Name = manga.ReleaseSchedule
+		setProperty(notionCreateBody.Properties, fieldReleaseSchedule, manga.ReleaseSchedule)
+	}
 
-		notionCreateBody.Properties.ReleaseSchedule = &ReleaseSchedule{
-			MultiSelect: releaseScheduleMultiSelect,
+	if manga.Rating != 0 {
+		setProperty(notionCreateBody.Properties, fieldRating, manga.Rating)
+	}
+
+	if manga.Art != "" {
+		notionCreateBody.Cover = externalFile(manga.Art)
+
+		if coverAsIcon {
+			notionCreateBody.Icon = externalFile(manga.Art)
 		}
 	}
 
+	if manga.Description != "" {
+		notionCreateBody.Children = append(notionCreateBody.Children, Children{
+			Object:    "block",
+			Type:      "paragraph",
+			Paragraph: blockText(manga.Description),
+		})
+	}
+
+	createdPage, ok := postNotionPage(ctx, notionCreateBody)
+
+	if !ok {
+		slog.Error("Error creating notion page", "url", manga.Link)
+
+		return
+	}
+
+	pageState := PageState{
+		Title: manga.Title,
+	}
+
+	if notionCreateBody.Cover != nil {
+		pageState.Cover = manga.Art
+	}
+
+	if notionCreateBody.Icon != nil {
+		pageState.Icon = manga.Art
+	}
+
+	if getSchema().has(fieldPublicationStatus) {
+		pageState.PublicationStatus = manga.PublicationStatus
+	}
+
+	setPageState(createdPage.ID, pageState)
+}
+
+func postNotionPage(ctx context.Context, notionCreateBody interface{}) (NotionPagesResponseResults, bool) {
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: apiTransport,
+	}
+
+	var createdPage NotionPagesResponseResults
+
 	body, err := json.Marshal(notionCreateBody)
 
 	if err != nil {
-		log.Printf("Error creating body for creating new page, mangaId: %s err: %s \n", manga.ID, err)
+		slog.Error("Error creating body for creating new page", "err", err)
+
+		return createdPage, false
 	}
 
-	req, _ := http.NewRequest("POST", "https://api.notion.com/v1/pages", bytes.NewBuffer(body))
+	req, _ := http.NewRequestWithContext(context.WithoutCancel(ctx), "POST", notionAPI+"/pages", bytes.NewBuffer(body))
 	req.Header.Add("Authorization", "Bearer "+notionSecret)
-	req.Header.Add("Notion-Version", "2021-08-16")
+	req.Header.Add("Notion-Version", notionVersion)
 	req.Header.Add("Content-Type", "application/json")
 
 	res, err := client.Do(req)
 
 	if err != nil || res.StatusCode != 200 {
-		log.Printf("Error creating notion page, mangaID: %s err: %s \n", manga.ID, err)
+		slog.Error("Error creating notion page", "err", err, "status_code", statusCode(res), "message", errorMessage(res))
+		closeResponse(res)
+		recordPageWrite(true, false)
+
+		return createdPage, false
 	}
 	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(&createdPage); err != nil {
+		slog.Error("Error parsing response body for created page", "err", err)
+		recordPageWrite(true, false)
+
+		return createdPage, false
+	}
+
+	recordPageWrite(true, true)
+
+	return createdPage, true
+}
+
+// blockText returns the text of a block in the shape of the configured Notion
+// version.
+func blockText(content string) *Paragraph {
+	if notionVersion >= "2022-02-22" {
+		return &Paragraph{RichText: richText(content)}
+	}
+
+	return &Paragraph{Text: richText(content)}
+}
+
+// richText splits content into text objects that stay below Notion's limit of
+// 2000 characters per rich text object.
+func richText(content string) []Titles {
+	titles := []Titles{}
+	runes := []rune(content)
+
+	for len(runes) > 0 {
+		end := len(runes)
+		if end > 2000 {
+			end = 2000
+		}
+
+		var title Titles
+		title.Text.Content = string(runes[:end])
+		titles = append(titles, title)
+		runes = runes[end:]
+	}
+
+	return titles
+}
+
+func metadataPropertiesForManga(manga Manga) map[string]interface{} {
+	properties := make(map[string]interface{})
+
+	if len(manga.AltTitles) > 0 {
+		setProperty(properties, fieldAltTitles, strings.Join(manga.AltTitles, "; "))
+	}
+
+	if len(manga.Authors) > 0 {
+		setProperty(properties, fieldAuthor, manga.Authors)
+	}
+
+	if len(manga.Genres) > 0 {
+		setProperty(properties, fieldGenres, manga.Genres)
+	}
+
+	if manga.PublicationStatus != "" {
+		setProperty(properties, fieldPublicationStatus, manga.PublicationStatus)
+	}
+
+	if manga.Demographic != "" {
+		setProperty(properties, fieldDemographic, manga.Demographic)
+	}
+
+	if manga.Year != 0 {
+		setProperty(properties, fieldYear, manga.Year)
+	}
+
+	if manga.LastVolume != "" {
+		setProperty(properties, fieldLastVolume, manga.LastVolume)
+	}
+
+	if manga.LastChapter != 0 {
+		setProperty(properties, fieldLastChapter, manga.LastChapter)
+	}
+
+	return properties
+}
+
+// NotionFilter is a Notion database query filter, see
+// https://developers.notion.com/reference/post-database-query-filter
+type NotionFilter map[string]interface{}
+
+// linkFilter matches pages whose Link contains (or, with does_not_contain, lacks)
+// the given domain.
+func linkFilter(condition string, domain string) NotionFilter {
+	link := getSchema().Properties[fieldLink]
+
+	return NotionFilter{
+		"property": link.Name,
+		link.Type: map[string]string{
+			condition: domain,
+		},
+	}
 }
 
-func getNotionPages(includeMangaDex bool) []Manga {
+// getNotionPages queries all pages of the database that match filter. A nil
+// filter returns every page. It returns false when the database could not be
+// read completely, so callers never mistake a failed query for an empty one.
+func getNotionPages(ctx context.Context, filter NotionFilter) ([]Manga, bool) {
 	client := &http.Client{
-		Timeout: time.Second * 30,
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
 	}
 	var nextCursor string
 	var pages []NotionPagesResponseResults
 
 	for {
-		var body *strings.Reader
+		query := make(map[string]interface{})
+
+		if filter != nil {
+			query["filter"] = filter
+		}
 
-		if nextCursor != "" && !includeMangaDex {
-			body = strings.NewReader(fmt.Sprintf("{\"start_cursor\": \"%s\", \"filter\": {\"property\": \"Link\", \"url\": { \"does_not_contain\": \"mangadex\" }}}", nextCursor))
-		} else if includeMangaDex && nextCursor == "" {
-			body = strings.NewReader("{\"filter\": {\"property\": \"Link\", \"url\": { \"contains\": \"mangadex\" }}}")
-		} else if includeMangaDex && nextCursor != "" {
-			body = strings.NewReader(fmt.Sprintf("{\"filter\": {\"property\": \"Link\", \"url\": { \"contains\": \"mangadex\" }}, \"start_cursor\": \"%s\"}", nextCursor))
-		} else if !includeMangaDex && nextCursor == "" {
-			body = strings.NewReader("{\"filter\": {\"property\": \"Link\", \"url\": { \"does_not_contain\": \"mangadex\" }}}")
+		if nextCursor != "" {
+			query["start_cursor"] = nextCursor
 		}
 
-		req, _ := http.NewRequest("POST", fmt.Sprintf("https://api.notion.com/v1/databases/%s/query", notionDatabaseId), body)
+		body, _ := json.Marshal(query)
+
+		req, _ := http.NewRequestWithContext(ctx, "POST", notionAPI+"/databases/"+notionDatabaseId+"/query", bytes.NewBuffer(body))
 
 		req.Header.Add("Authorization", "Bearer "+notionSecret)
-		req.Header.Add("Notion-Version", "2021-08-16")
+		req.Header.Add("Notion-Version", notionVersion)
 		req.Header.Add("Content-Type", "application/json")
 		res, err := client.Do(req)
 
 		if err != nil || res.StatusCode != 200 {
-			log.Printf("Error retrieving database pages, err: %s statuscode: %v \n", err, res.StatusCode)
-		}
+			slog.Error("Error retrieving database pages", "err", err, "status_code", statusCode(res))
+			closeResponse(res)
 
-		defer res.Body.Close()
+			return nil, false
+		}
 
 		var notionPagesResponse NotionPagesResponse
 
 		err = json.NewDecoder(res.Body).Decode(&notionPagesResponse)
+		res.Body.Close()
 
 		if err != nil {
-			log.Printf("Error parsing response body, err: %s \n", err)
+			slog.Error("Error parsing response body for database pages", "err", err)
+
+			return nil, false
+		}
+
+		for _, result := range notionPagesResponse.Results {
+			var page NotionPagesResponseResults
+
+			if err := json.Unmarshal(result, &page); err != nil {
+				slog.Error("Error parsing database page, skipping it", "err", err)
+				continue
+			}
+
+			pages = append(pages, page)
 		}
 
 		nextCursor = notionPagesResponse.NextCursor
-		pages = append(pages, notionPagesResponse.Results...)
-		if !notionPagesResponse.HasMore {
+		if !notionPagesResponse.HasMore || nextCursor == "" {
 			break
 		}
 	}
@@ -397,32 +1080,46 @@ func getNotionPages(includeMangaDex bool) []Manga {
 	for _, page := range pages {
 		manga := Manga{
 			ID:                     page.ID,
-			Type:                   page.Properties.Type.Select.Name,
-			Title:                  page.Properties.Title.Title[0].Text.Content,
-			Link:                   page.Properties.Link.Url,
-			CurrentProgress:        page.Properties.CurrentProgress.Number,
-			LatestRelease:          page.Properties.LatestRelease.Number,
-			LatestReleaseUpdatedAt: page.Properties.LatestReleaseUpdatedAt.Date.Start,
-			SeenLatestRelease:      page.Properties.SeenLatestRelease.Checkbox,
+			Type:                   page.Properties.text(fieldType),
+			Title:                  page.Properties.text(fieldTitle),
+			Link:                   page.Properties.text(fieldLink),
+			Status:                 page.Properties.options(fieldStatus),
+			CurrentProgress:        page.Properties.number(fieldCurrentProgress),
+			LatestRelease:          page.Properties.number(fieldLatestRelease),
+			LatestReleaseUpdatedAt: page.Properties.date(fieldLatestReleaseUpdatedAt),
+			SeenLatestRelease:      page.Properties.checkbox(fieldSeenLatestRelease),
 			ReleaseSchedule:        "",
-			Rating:                 page.Properties.Rating.Number,
+			Rating:                 page.Properties.number(fieldRating),
+			PublicationStatus:      page.Properties.text(fieldPublicationStatus),
+			LastChapter:            page.Properties.number(fieldLastChapter),
+			Muted:                  page.Properties.checkbox(fieldMuteNotifications),
+			ChaptersBehind:         page.Properties.number(fieldChaptersBehind),
+			UnreadSince:            page.Properties.date(fieldUnreadSince),
 		}
 
-		if len(page.Properties.ReleaseSchedule.MultiSelect) > 0 {
-			manga.ReleaseSchedule = page.Properties.ReleaseSchedule.MultiSelect[0].Name
+		manga.Art = imageValue(page.Cover)
+		manga.Icon = imageValue(page.Icon)
+
+		if author := page.Properties.text(fieldAuthor); author != "" {
+			manga.Authors = []string{author}
 		}
 
-		var statusses []string
-		for _, status := range page.Properties.Status.MultiSelect {
-			statusses = append(statusses, status.Name)
+		if altTitles := page.Properties.text(fieldAltTitles); altTitles != "" {
+			manga.AltTitles = []string{altTitles}
 		}
 
-		manga.Status = statusses
+		if schedule := page.Properties.options(fieldReleaseSchedule); len(schedule) > 0 {
+			manga.ReleaseSchedule = schedule[0]
+		}
 
 		mangas = append(mangas, manga)
 	}
 
-	return mangas
+	return mangas, true
+}
+
+func getAllNotionPages(ctx context.Context) ([]Manga, bool) {
+	return getNotionPages(ctx, nil)
 }
 
 func currentDay() string {
@@ -440,63 +1137,205 @@ func contains(s []string, str string) bool {
 	return false
 }
 
-func syncNotionPagesWithIntegrations() {
-	mangas := getNotionPages(false)
+func syncNotionPagesWithIntegrations(ctx context.Context) {
+	var filters []NotionFilter
+
+	// Pages that belong to an enabled list integration are kept up to date by it
+	for _, integration := range integrations() {
+		if integration.Enabled() {
+			filters = append(filters, linkFilter("does_not_contain", integration.LinkDomain()))
+		}
+	}
+
+	// Notion rejects an empty compound filter
+	var filter NotionFilter
+	if len(filters) > 0 {
+		filter = NotionFilter{
+			"and": filters,
+		}
+	}
+
+	mangas, ok := getNotionPages(ctx, filter)
+	if !ok {
+		return
+	}
 
 	if len(mangas) > 0 {
+		sources := releaseSources()
+		anime := animeSources()
+
 		for _, manga := range mangas {
-			if manga.ReleaseSchedule == "" || manga.ReleaseSchedule == currentDay() {
-				if !(contains(manga.Status, Completed) || contains(manga.Status, Dropped) || contains(manga.Status, DoneAiring)) {
-					if strings.Contains(manga.Link, "pahe.win") || strings.Contains(manga.Link, "animepahe.com") {
-						t, _ := time.Parse("2006-01-02T15:04:05.000+03:00", manga.LatestReleaseUpdatedAt)
-						if t.Format("2006-01-02") != time.Now().In(loc).Format("2006-01-02") {
-							go updateNotionPage(manga.ID, manga.LatestRelease+1, "", "")
-						}
-					} else {
-						latestChapter := CrawlManga(manga.Link, manga.LatestRelease)
+			manga := manga
+
+			if ctx.Err() != nil {
+				break
+			}
 
-						if latestChapter != 0 && latestChapter > manga.LatestRelease {
-							go updateNotionPage(manga.ID, latestChapter, "", "")
+			syncPage(manga.Link, func() {
+				if manga.ReleaseSchedule == "" || manga.ReleaseSchedule == currentDay() {
+					if !(contains(manga.Status, Completed) || contains(manga.Status, Dropped) || contains(manga.Status, DoneAiring)) {
+						if isAnime(manga) {
+							syncAnimeEpisodes(ctx, manga, anime)
+						} else {
+							var series ScrapedSeries
+
+							for _, source := range sources {
+								if source.Matches(manga) {
+									series = fetchRelease(ctx, source, manga)
+									break
+								}
+							}
+
+							if series.LatestChapter != 0 && series.LatestChapter > manga.LatestRelease {
+								if series.LatestReleaseGroup != "" {
+									slog.Info("New chapter released", "page_id", manga.ID, "source", series.Source, "url", manga.Link, "chapter", series.LatestChapter, "group", series.LatestReleaseGroup)
+								}
+
+								recordNewRelease(series.Source)
+								goWrite(func() { releaseChapter(ctx, manga, series.LatestChapter, series.LatestReleaseDate, "") })
+							}
+
+							fillNotionPage(ctx, manga, series)
 						}
 					}
 				}
-			}
+			})
+		}
+	}
+}
+
+// syncListRelease looks up the latest release of a page whose list doesn't count
+// the chapters of releasing series, as AniList, MyAnimeList and Kitsu do. The
+// scrapers can't read list links, so only the other release sources are asked.
+func syncListRelease(ctx context.Context, manga Manga, status string) {
+	for _, source := range releaseSources() {
+		if _, scraper := source.(scraperSource); scraper || !source.Matches(manga) {
+			continue
+		}
+
+		series := fetchRelease(ctx, source, manga)
+
+		if series.LatestChapter > manga.LatestRelease {
+			slog.Info("Updating latest release", "page_id", manga.ID, "source", series.Source, "url", manga.Link)
+
+			recordNewRelease(series.Source)
+			goWrite(func() { releaseChapter(ctx, manga, series.LatestChapter, series.LatestReleaseDate, status) })
 		}
+
+		return
 	}
 }
 
-func syncMangaDexWithNotion() {
-	notionMangas := getNotionPages(true)
-	mangas := SyncMangaDex()
+// findNotionPage returns the page of manga. A page with the same link is
+// preferred, pages are only matched by title when they are of the same type, so
+// an anime doesn't match the manga it is adapted from.
+func findNotionPage(notionMangas []Manga, manga Manga) (Manga, bool) {
+	for _, notionManga := range notionMangas {
+		if manga.Link == notionManga.Link {
+			return notionManga, true
+		}
+	}
+
+	for _, notionManga := range notionMangas {
+		if manga.Title == notionManga.Title && isAnime(manga) == isAnime(notionManga) {
+			return notionManga, true
+		}
+	}
+
+	return Manga{}, false
+}
+
+func syncIntegrationWithNotion(ctx context.Context, integration ListIntegration) {
+	slog.Info("Syncing integration with notion", "source", integration.Name())
+
+	// Without the current pages every series would look new and be created again
+	notionMangas, ok := getNotionPages(ctx, linkFilter("contains", integration.LinkDomain()))
+	if !ok {
+		return
+	}
+
+	mangas := integration.Fetch(ctx)
+
+	if len(mangas) > 0 {
+		recordSourceSuccess(integration.Name())
+	} else {
+		recordSourceFailure(integration.Name(), "no series returned")
+	}
 
 	if len(notionMangas) > 0 && len(mangas) > 0 {
 		for _, manga := range mangas {
-			if !(contains(manga.Status, Completed) || contains(manga.Status, Dropped) || contains(manga.Status, DoneAiring)) {
-				for key, notionManga := range notionMangas {
+			manga := manga
+
+			if ctx.Err() != nil {
+				break
+			}
+
+			syncPage(manga.Link, func() {
+				if !(contains(manga.Status, Completed) || contains(manga.Status, Dropped) || contains(manga.Status, DoneAiring)) {
+					notionManga, found := findNotionPage(notionMangas, manga)
+
+					if !found {
+						// Manga doesn't exist in notion and should be added
+						slog.Info("Creating new notion page", "source", integration.Name(), "url", manga.Link)
+
+						goWrite(func() { createNotionPage(ctx, manga) })
+						return
+					}
+
 					// Manga exists in notion and should be updated
-					if manga.Link == notionManga.Link || manga.Title == notionManga.Title {
-						log.Printf("Syncing %s \n", manga.Link)
+					slog.Info("Syncing series", "page_id", notionManga.ID, "source", integration.Name(), "url", manga.Link)
+
+					if manga.CurrentProgress > notionManga.CurrentProgress {
+						slog.Info("Updating progress", "page_id", notionManga.ID, "source", integration.Name(), "url", manga.Link)
 
-						if manga.LatestRelease > notionManga.LatestRelease {
-							log.Printf("Updating manga with link: %s \n", manga.Link)
+						if updateProgress(ctx, notionManga.ID, manga.CurrentProgress) {
+							notionManga.CurrentProgress = manga.CurrentProgress
+						}
+					} else if pusher, ok := integration.(ProgressPusher); ok && notionManga.CurrentProgress > manga.CurrentProgress {
+						pusher.PushProgress(ctx, manga, notionManga.CurrentProgress)
+					}
+
+					if manga.Rating != 0 && manga.Rating != notionManga.Rating {
+						slog.Info("Updating rating", "page_id", notionManga.ID, "source", integration.Name(), "url", manga.Link)
+
+						updateRating(ctx, notionManga.ID, manga.Rating)
+					}
+
+					if manga.LatestRelease > notionManga.LatestRelease {
+						slog.Info("Updating latest release", "page_id", notionManga.ID, "source", integration.Name(), "url", manga.Link)
+
+						bumped := notionManga
+						bumped.Art = manga.Art
 
-							go updateNotionPage(notionManga.ID, manga.LatestRelease, manga.LatestReleaseUpdatedAt, manga.Status[0])
+						recordNewRelease(integration.Name())
+						// Both writes set the status, so the series is only marked
+						// finished once the release is written
+						goWrite(func() {
+							releaseChapter(ctx, bumped, manga.LatestRelease, manga.LatestReleaseUpdatedAt, manga.Status[0])
+							markFinishedSeries(ctx, notionManga, manga)
+						})
+					} else {
+						if manga.LatestRelease == 0 && !isAnime(manga) {
+							syncListRelease(ctx, notionManga, manga.Status[0])
 						}
 
-						break
-					} else if key+1 == len(notionMangas) {
-						// Manga doesn't exist in notion and should be added
-						log.Printf("Creating new notion page for %s \n", manga.Link)
+						markFinishedSeries(ctx, notionManga, manga)
+					}
 
-						go createNotionPage(manga)
+					if refreshMetadata {
+						refreshNotionPage(ctx, notionManga, manga)
 					}
+
+					recordListAirings(ctx, notionManga)
 				}
-			}
+			})
 		}
 	} else if len(mangas) > 0 && len(notionMangas) == 0 {
 		for _, manga := range mangas {
-			log.Printf("Creating new notion page for %s \n", manga.Link)
-			go createNotionPage(manga)
+			manga := manga
+
+			slog.Info("Creating new notion page", "source", integration.Name(), "url", manga.Link)
+			goWrite(func() { createNotionPage(ctx, manga) })
 		}
 	}
 }
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// isGarbage reports whether body doesn't start with a JSON value. Decoders stop
+// after the first value, so trailing bytes are not garbage to them.
+func isGarbage(body []byte) bool {
+	var v interface{}
+
+	return json.NewDecoder(bytes.NewReader(body)).Decode(&v) != nil
+}
+
+// fuzzServer serves the body it was last given to the first request and an
+// empty response to the following ones, so a fuzzed cursor cannot paginate
+// forever.
+type fuzzServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	status int
+	body   []byte
+	served bool
+}
+
+func newFuzzServer(tb testing.TB) *fuzzServer {
+	s := &fuzzServer{}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if s.served {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		s.served = true
+		w.WriteHeader(s.status)
+		w.Write(s.body)
+	}))
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// setNotionAPI points the Notion client at url until the test is done.
+func setNotionAPI(tb testing.TB, url string) {
+	previous := notionAPI
+	notionAPI = url
+	tb.Cleanup(func() { notionAPI = previous })
+}
+
+func (s *fuzzServer) serve(status int, body []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.status = status
+	s.body = body
+	s.served = false
+}
+
+func FuzzGetNotionPages(f *testing.F) {
+	f.Add([]byte(`{"results":[],"has_more":false}`))
+	f.Add([]byte(`{"results":[{"id":"1","properties":{"Title":{"title":[{"type":"text","text":{"content":"One Piece"},"plain_text":"One Piece"}]},"Type":{"select":{"name":"Manga"}},"Link":{"url":"https://mangadex.org/title/1"},"Status":{"multi_select":[{"name":"Reading"}]},"Current Progress":{"number":1090},"Latest Release":{"number":1100},"Latest Release Updated At":{"date":{"start":"2024-01-01"}},"Seen Latest Release":{"checkbox":false},"Release Schedule":{"multi_select":[{"name":"Sunday"}]},"Rating":{"number":9}}}],"has_more":false}`))
+	f.Add([]byte(`{"results":[{"id":"1","properties":{"Status":{"select":null},"Latest Release":{"number":"x"}},"cover":{"type":"file"},"icon":{"type":"emoji","emoji":"📖"}}],"has_more":true,"next_cursor":"abc"}`))
+	f.Add([]byte(`{"results":[null,1,"x"]}`))
+	f.Add([]byte(`{"results":{}}`))
+	f.Add([]byte(`<html>Bad Gateway</html>`))
+	f.Add([]byte(``))
+
+	loadSchema()
+
+	server := newFuzzServer(f)
+	setNotionAPI(f, server.URL)
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		server.serve(http.StatusOK, body)
+
+		_, ok := getNotionPages(context.Background(), nil)
+
+		if isGarbage(body) && ok {
+			t.Errorf("getNotionPages(%q) succeeded on garbage", body)
+		}
+	})
+}
+
+func TestGetNotionPagesErrorStatus(t *testing.T) {
+	loadSchema()
+	server := newFuzzServer(t)
+	server.serve(http.StatusBadGateway, []byte(`{"results":[]}`))
+	setNotionAPI(t, server.URL)
+
+	if mangas, ok := getNotionPages(context.Background(), nil); ok || mangas != nil {
+		t.Errorf("getNotionPages() = %v, %v, want nil, false", mangas, ok)
+	}
+}
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Profile is a person the tracker syncs for. Its variables override the
+// environment, so every profile can have its own Notion token and database, list
+// credentials and notification targets.
+type Profile struct {
+	Name string
+	Env  map[string]string
+}
+
+var profiles []Profile
+var activeProfile atomic.Pointer[Profile]
+var profileMutex sync.Mutex
+
+// loadProfiles reads PROFILES_FILE, a JSON object mapping profile names to the
+// environment variables they override. Without it there is a single unnamed
+// profile that uses the environment as is.
+//
+// Files written by the tracker, such as CALENDAR_FILE, should be set per profile.
+// The sync state and MyAnimeList token are kept per profile unless
+// SYNC_STATE_FILE or MAL_TOKEN_FILE is set.
+func loadProfiles() {
+	profiles = []Profile{{}}
+
+	path := os.Getenv("PROFILES_FILE")
+	if path == "" {
+		return
+	}
+
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		slog.Error("Error reading profiles file, using the environment only", "path", path, "err", err)
+		return
+	}
+
+	var envs map[string]map[string]string
+
+	if err := json.Unmarshal(body, &envs); err != nil {
+		slog.Error("Error parsing profiles file, using the environment only", "path", path, "err", err)
+		return
+	}
+
+	if len(envs) == 0 {
+		return
+	}
+
+	profiles = nil
+
+	for name, env := range envs {
+		profiles = append(profiles, Profile{Name: name, Env: env})
+	}
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+}
+
+// findProfile returns the profile called name. An empty name selects the first
+// profile.
+func findProfile(name string) (Profile, bool) {
+	for _, profile := range profiles {
+		if name == "" || profile.Name == name {
+			return profile, true
+		}
+	}
+
+	return Profile{}, false
+}
+
+// activateProfile loads the configuration of profile. It must be called with
+// profileMutex held.
+func activateProfile(profile Profile) {
+	activeProfile.Store(&profile)
+	readConfig()
+}
+
+// withProfile runs fn with the configuration of profile active. Profiles share
+// the package configuration, so only one of them is active at a time.
+func withProfile(profile Profile, fn func()) {
+	profileMutex.Lock()
+	defer profileMutex.Unlock()
+
+	activateProfile(profile)
+	fn()
+}
+
+// tryWithProfile runs fn like withProfile, unless another profile is active. It
+// reports whether fn ran.
+func tryWithProfile(profile Profile, fn func()) bool {
+	if !profileMutex.TryLock() {
+		return false
+	}
+	defer profileMutex.Unlock()
+
+	activateProfile(profile)
+	fn()
+
+	return true
+}
+
+// getenv returns the value of an environment variable as overridden by the
+// active profile.
+func getenv(key string) string {
+	if profile := activeProfile.Load(); profile != nil {
+		if value, ok := profile.Env[key]; ok {
+			return value
+		}
+	}
+
+	return os.Getenv(key)
+}
+
+func profileName() string {
+	if profile := activeProfile.Load(); profile != nil {
+		return profile.Name
+	}
+
+	return ""
+}
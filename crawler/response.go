@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// statusCode returns the status code of res, or 0 when the request failed before
+// a response was received.
+func statusCode(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+
+	return res.StatusCode
+}
+
+// closeResponse drains and closes the body of a response that is not going to
+// be read, so the connection can be reused. It accepts a nil response.
+func closeResponse(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+}
+
+// errorMessage returns the message of a JSON error response, such as the
+// validation errors of the Notion API. It accepts a nil response.
+func errorMessage(res *http.Response) string {
+	if res == nil || res.Body == nil {
+		return ""
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&body); err != nil {
+		return ""
+	}
+
+	return body.Message
+}
+
+// syncPage runs the sync of a single series and recovers from any panic in it,
+// so one malformed page or response does not take down the whole run.
+func syncPage(link string, sync func()) {
+	defer recoverPanic("Recovered from panic while syncing series", "url", link)
+
+	sync()
+}
+
+func recoverPanic(msg string, args ...any) {
+	if r := recover(); r != nil {
+		slog.Error(msg, append(args, "err", r, "stack", string(debug.Stack()))...)
+	}
+}
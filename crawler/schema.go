@@ -0,0 +1,741 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Logical fields of a series. The schema maps each of them to a property of the
+// Notion database.
+const (
+	fieldTitle                  = "title"
+	fieldType                   = "type"
+	fieldLink                   = "link"
+	fieldStatus                 = "status"
+	fieldCurrentProgress        = "current_progress"
+	fieldLatestRelease          = "latest_release"
+	fieldLatestReleaseUpdatedAt = "latest_release_updated_at"
+	fieldSeenLatestRelease      = "seen_latest_release"
+	fieldReleaseSchedule        = "release_schedule"
+	fieldRating                 = "rating"
+	fieldAltTitles              = "alt_titles"
+	fieldAuthor                 = "author"
+	fieldGenres                 = "genres"
+	fieldPublicationStatus      = "publication_status"
+	fieldDemographic            = "demographic"
+	fieldYear                   = "year"
+	fieldLastVolume             = "last_volume"
+	fieldLastChapter            = "last_chapter"
+	fieldChaptersBehind         = "chapters_behind"
+	fieldUnreadSince            = "unread_since"
+	fieldMuteNotifications      = "mute_notifications"
+)
+
+// SchemaProperty is the Notion property a field is stored in.
+type SchemaProperty struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// SchemaStatus is the option a status is written as.
+type SchemaStatus struct {
+	Name  string `json:"name"`
+	Color string `json:"color,omitempty"`
+}
+
+// Schema maps the fields of a series to the properties of the Notion database,
+// and the statuses to the options of the status property. Fields without a
+// property name are not synced.
+type Schema struct {
+	Properties map[string]SchemaProperty `json:"properties"`
+	Statuses   map[string]SchemaStatus   `json:"statuses"`
+}
+
+var currentSchema atomic.Pointer[Schema]
+
+// getSchema returns the schema in use. It is replaced as a whole and never
+// changed in place, so it can be read while property types are detected.
+func getSchema() *Schema {
+	if schema := currentSchema.Load(); schema != nil {
+		return schema
+	}
+
+	return &Schema{}
+}
+
+// propertyTypes lists the property types each field can be stored as.
+var propertyTypes = map[string][]string{
+	fieldTitle:                  {"title", "rich_text"},
+	fieldType:                   {"select", "rich_text"},
+	fieldLink:                   {"url", "rich_text"},
+	fieldStatus:                 {"multi_select", "select", "status"},
+	fieldCurrentProgress:        {"number"},
+	fieldLatestRelease:          {"number"},
+	fieldLatestReleaseUpdatedAt: {"date"},
+	fieldSeenLatestRelease:      {"checkbox"},
+	fieldReleaseSchedule:        {"multi_select", "select"},
+	fieldRating:                 {"number"},
+	fieldAltTitles:              {"rich_text", "multi_select"},
+	fieldAuthor:                 {"rich_text", "select", "multi_select"},
+	fieldGenres:                 {"multi_select", "rich_text"},
+	fieldPublicationStatus:      {"select", "rich_text"},
+	fieldDemographic:            {"select", "rich_text"},
+	fieldYear:                   {"number"},
+	fieldLastVolume:             {"rich_text", "number"},
+	fieldLastChapter:            {"number"},
+	fieldChaptersBehind:         {"number"},
+	fieldUnreadSince:            {"date"},
+	fieldMuteNotifications:      {"checkbox"},
+}
+
+// optionalFields are used when the database has them and skipped when it doesn't,
+// so they have a default name without breaking databases created before them.
+var optionalFields = []string{fieldMuteNotifications, fieldChaptersBehind, fieldUnreadSince}
+
+// defaultSchema returns the schema of the original database. The optional
+// metadata properties keep their NOTION_*_PROPERTY variables, the backlog and
+// mute properties default to their standard names.
+func defaultSchema() Schema {
+	muteProperty := getenv("NOTION_MUTE_PROPERTY")
+	if muteProperty == "" {
+		muteProperty = "Mute Notifications"
+	}
+
+	chaptersBehindProperty := getenv("NOTION_CHAPTERS_BEHIND_PROPERTY")
+	if chaptersBehindProperty == "" {
+		chaptersBehindProperty = "Chapters Behind"
+	}
+
+	unreadSinceProperty := getenv("NOTION_UNREAD_SINCE_PROPERTY")
+	if unreadSinceProperty == "" {
+		unreadSinceProperty = "Unread Since"
+	}
+
+	return Schema{
+		Properties: map[string]SchemaProperty{
+			fieldTitle:                  {Name: "Title", Type: "title"},
+			fieldType:                   {Name: "Type", Type: "select"},
+			fieldLink:                   {Name: "Link", Type: "url"},
+			fieldStatus:                 {Name: "Status", Type: "multi_select"},
+			fieldCurrentProgress:        {Name: "Current Progress", Type: "number"},
+			fieldLatestRelease:          {Name: "Latest Release", Type: "number"},
+			fieldLatestReleaseUpdatedAt: {Name: "Latest Release Updated At", Type: "date"},
+			fieldSeenLatestRelease:      {Name: "Seen Latest Release", Type: "checkbox"},
+			fieldReleaseSchedule:        {Name: "Release Schedule", Type: "multi_select"},
+			fieldRating:                 {Name: "Rating", Type: "number"},
+			fieldAltTitles:              {Name: getenv("NOTION_ALT_TITLES_PROPERTY"), Type: "rich_text"},
+			fieldAuthor:                 {Name: getenv("NOTION_AUTHOR_PROPERTY"), Type: "rich_text"},
+			fieldGenres:                 {Name: getenv("NOTION_GENRES_PROPERTY"), Type: "multi_select"},
+			fieldPublicationStatus:      {Name: getenv("NOTION_PUBLICATION_STATUS_PROPERTY"), Type: "select"},
+			fieldDemographic:            {Name: getenv("NOTION_DEMOGRAPHIC_PROPERTY"), Type: "select"},
+			fieldYear:                   {Name: getenv("NOTION_YEAR_PROPERTY"), Type: "number"},
+			fieldLastVolume:             {Name: getenv("NOTION_LAST_VOLUME_PROPERTY"), Type: "rich_text"},
+			fieldLastChapter:            {Name: getenv("NOTION_LAST_CHAPTER_PROPERTY"), Type: "number"},
+			fieldChaptersBehind:         {Name: chaptersBehindProperty, Type: "number"},
+			fieldUnreadSince:            {Name: unreadSinceProperty, Type: "date"},
+			fieldMuteNotifications:      {Name: muteProperty, Type: "checkbox"},
+		},
+		Statuses: map[string]SchemaStatus{
+			Dropped:         {Name: Dropped, Color: "brown"},
+			DoneAiring:      {Name: DoneAiring, Color: "green"},
+			Completed:       {Name: Completed, Color: "pink"},
+			PlanningToRead:  {Name: PlanningToRead, Color: "purple"},
+			PlanningToWatch: {Name: PlanningToWatch, Color: "purple"},
+			Watching:        {Name: Watching, Color: "red"},
+			Reading:         {Name: Reading, Color: "red"},
+			OnHold:          {Name: OnHold, Color: "blue"},
+		},
+	}
+}
+
+func loadSchema() {
+	schema := readSchema()
+	currentSchema.Store(&schema)
+}
+
+// readSchema reads the schema mapping from NOTION_SCHEMA_FILE on top of the
+// defaults. Properties and statuses left out of the file keep their defaults, as
+// do a name or type left out of an entry.
+func readSchema() Schema {
+	schema := defaultSchema()
+
+	path := getenv("NOTION_SCHEMA_FILE")
+	if path == "" {
+		return schema
+	}
+
+	body, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		slog.Error("Error reading schema file, using the default schema", "path", path, "err", err)
+		return schema
+	}
+
+	var mapping Schema
+
+	if err := json.Unmarshal(body, &mapping); err != nil {
+		slog.Error("Error parsing schema file, using the default schema", "path", path, "err", err)
+		return schema
+	}
+
+	for field, property := range mapping.Properties {
+		current, ok := schema.Properties[field]
+		if !ok {
+			slog.Warn("Unknown field in schema file", "path", path, "field", field)
+			continue
+		}
+
+		if property.Name != "" {
+			current.Name = property.Name
+		}
+
+		if property.Type != "" {
+			if !contains(propertyTypes[field], property.Type) {
+				slog.Warn("Unsupported property type in schema file, keeping the default", "path", path, "field", field, "type", property.Type)
+			} else {
+				current.Type = property.Type
+			}
+		}
+
+		schema.Properties[field] = current
+	}
+
+	for status, option := range mapping.Statuses {
+		current := schema.Statuses[status]
+
+		if option.Name != "" {
+			current.Name = option.Name
+		}
+
+		if option.Color != "" {
+			current.Color = option.Color
+		}
+
+		schema.Statuses[status] = current
+	}
+
+	return schema
+}
+
+// has reports whether field is mapped to a property.
+func (s Schema) has(field string) bool {
+	return s.Properties[field].Name != ""
+}
+
+// name returns the name of the property field is stored in.
+func (s Schema) name(field string) string {
+	return s.Properties[field].Name
+}
+
+// statusOption returns the option a status is written as. Statuses that are not
+// in the schema are written as is.
+func (s Schema) statusOption(status string) SchemaStatus {
+	if option, ok := s.Statuses[status]; ok && option.Name != "" {
+		return option
+	}
+
+	return SchemaStatus{Name: status}
+}
+
+// statusFromOption translates an option of the status property back to the
+// status it stands for.
+func (s Schema) statusFromOption(name string) string {
+	for status, option := range s.Statuses {
+		if option.Name == name {
+			return status
+		}
+	}
+
+	return name
+}
+
+// setProperty writes value to the property field is mapped to, encoded for the
+// type of that property. Values are a string, a list of strings, a number or a
+// bool. Fields that are not mapped are skipped, as are empty options.
+func setProperty(properties map[string]interface{}, field string, value interface{}) {
+	property, ok := getSchema().Properties[field]
+	if !ok || property.Name == "" {
+		return
+	}
+
+	if encoded := encodeProperty(field, property.Type, value); encoded != nil {
+		properties[property.Name] = encoded
+	}
+}
+
+func encodeProperty(field string, propertyType string, value interface{}) interface{} {
+	switch propertyType {
+	case "title":
+		return Title{Title: richText(textOf(value))}
+	case "rich_text":
+		return RichText{RichText: richText(textOf(value))}
+	case "url":
+		return UrlProperty{Url: textOf(value)}
+	case "number":
+		return NumberProperty{Number: numberOf(value)}
+	case "checkbox":
+		checked, _ := value.(bool)
+		return CheckboxProperty{Checkbox: checked}
+	case "date":
+		// An empty date clears the property
+		if start := textOf(value); start != "" {
+			return DateProperty{Date: &Date{Start: start}}
+		}
+
+		return DateProperty{}
+	case "select":
+		options := optionsOf(field, value)
+		if len(options) == 0 {
+			return nil
+		}
+
+		return SelectProperty{Select: Select{Name: options[0].Name}}
+	case "status":
+		// Options of a status property cannot be created through the API, nor
+		// can their colors be set
+		options := optionsOf(field, value)
+		if len(options) == 0 {
+			return nil
+		}
+
+		return StatusProperty{Status: Select{Name: options[0].Name}}
+	case "multi_select":
+		return MultiSelectProperty{MultiSelect: optionsOf(field, value)}
+	default:
+		return nil
+	}
+}
+
+func textOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	default:
+		return ""
+	}
+}
+
+func numberOf(value interface{}) float32 {
+	switch v := value.(type) {
+	case float32:
+		return v
+	case int:
+		return float32(v)
+	case string:
+		number, _ := strconv.ParseFloat(v, 32)
+		return float32(number)
+	default:
+		return 0
+	}
+}
+
+// optionsOf turns value into select options. Statuses are translated to their
+// options in the schema, including their colors. Notion rejects option names
+// with a comma, so commas are dropped, as in "Yes Chef!" for "Yes, Chef!".
+func optionsOf(field string, value interface{}) []MultiSelect {
+	var names []string
+
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			names = []string{v}
+		}
+	case []string:
+		names = v
+	}
+
+	options := make([]MultiSelect, 0, len(names))
+
+	for _, name := range names {
+		if field == fieldStatus {
+			option := getSchema().statusOption(name)
+			options = append(options, MultiSelect{Name: option.Name, Color: option.Color})
+		} else if name = strings.TrimSpace(strings.ReplaceAll(name, ",", "")); name != "" {
+			options = append(options, MultiSelect{Name: name})
+		}
+	}
+
+	return options
+}
+
+// text returns the value of field as text, whatever the type of its property.
+func (p NotionProperties) text(field string) string {
+	property := getSchema().Properties[field]
+
+	switch property.Type {
+	case "title":
+		return p.titleValue(property.Name)
+	case "rich_text":
+		return p.richTextValue(property.Name)
+	case "url":
+		return p.urlValue(property.Name)
+	case "select":
+		return p.selectValue(property.Name)
+	case "status":
+		return p.statusValue(property.Name)
+	case "multi_select":
+		return strings.Join(p.multiSelectValue(property.Name), ", ")
+	default:
+		return ""
+	}
+}
+
+// options returns the options of a select, status or multi-select field. Statuses are
+// translated back from their options in the schema.
+func (p NotionProperties) options(field string) []string {
+	property := getSchema().Properties[field]
+	var options []string
+
+	switch property.Type {
+	case "multi_select":
+		options = p.multiSelectValue(property.Name)
+	case "select", "status", "rich_text":
+		if option := p.text(field); option != "" {
+			options = []string{option}
+		}
+	}
+
+	if field == fieldStatus {
+		for key, option := range options {
+			options[key] = getSchema().statusFromOption(option)
+		}
+	}
+
+	return options
+}
+
+func (p NotionProperties) number(field string) float32 {
+	property := getSchema().Properties[field]
+
+	if property.Type == "rich_text" {
+		return numberOf(p.richTextValue(property.Name))
+	}
+
+	return p.numberValue(property.Name)
+}
+
+func (p NotionProperties) date(field string) string {
+	return p.dateValue(getSchema().name(field))
+}
+
+func (p NotionProperties) checkbox(field string) bool {
+	return p.checkboxValue(getSchema().name(field))
+}
+
+// NotionDatabase is a database as returned by the Notion API.
+type NotionDatabase struct {
+	ID         string                            `json:"id"`
+	Properties map[string]NotionDatabaseProperty `json:"properties"`
+}
+
+// NotionDatabaseProperty is the definition of a database property. Only the
+// options of select, multi-select and status properties are decoded.
+type NotionDatabaseProperty struct {
+	Type        string                 `json:"type"`
+	Select      *NotionPropertyOptions `json:"select,omitempty"`
+	MultiSelect *NotionPropertyOptions `json:"multi_select,omitempty"`
+	Status      *NotionPropertyOptions `json:"status,omitempty"`
+}
+
+type NotionPropertyOptions struct {
+	Options []MultiSelect `json:"options"`
+}
+
+// CheckSchema compares the database at NOTION_DATABASE_ID with the schema and
+// writes a report to w. It returns false when a mapped property is missing or
+// has a type the field cannot be stored as. A property of another supported
+// type is fine, as types are detected at the start of every sync. Missing status
+// options only fail the check for a status property, as Notion adds select and
+// multi-select options on the first write.
+func CheckSchema(ctx context.Context, w io.Writer) (bool, error) {
+	loadConfig()
+
+	database, err := getNotionDatabase(ctx, notionDatabaseId)
+
+	if err != nil {
+		return false, err
+	}
+
+	ok := true
+
+	for _, field := range schemaFields() {
+		property := getSchema().Properties[field]
+		actual, found := database.Properties[property.Name]
+
+		switch {
+		case !found && contains(optionalFields, field):
+			// Pages without the mute property are never muted, backlog
+			// properties are only written when they exist
+			fmt.Fprintf(w, "note      %s: optional property %q of type %s does not exist\n", field, property.Name, property.Type)
+		case !found:
+			ok = false
+			fmt.Fprintf(w, "missing   %s: property %q of type %s does not exist\n", field, property.Name, property.Type)
+		case !contains(propertyTypes[field], actual.Type):
+			ok = false
+			fmt.Fprintf(w, "mistyped  %s: property %q is a %s, expected one of %s\n", field, property.Name, actual.Type, strings.Join(propertyTypes[field], ", "))
+		case actual.Type != property.Type:
+			fmt.Fprintf(w, "ok        %s: %q (%s, detected instead of %s)\n", field, property.Name, actual.Type, property.Type)
+		default:
+			fmt.Fprintf(w, "ok        %s: %q (%s)\n", field, property.Name, property.Type)
+		}
+
+		if found && field == fieldStatus && contains(propertyTypes[field], actual.Type) {
+			for _, option := range missingStatusOptions(actual) {
+				if actual.Type == "status" {
+					ok = false
+					fmt.Fprintf(w, "missing   %s: option %q does not exist, add it to the status property in Notion\n", field, option)
+				} else {
+					fmt.Fprintf(w, "note      %s: option %q does not exist yet\n", field, option)
+				}
+			}
+		}
+	}
+
+	return ok, nil
+}
+
+// detectSchemaTypes switches the fields of the schema to the property types the
+// database actually uses, when the field supports them. This lets a database be
+// migrated, for example from a multi-select Status to Notion's status type,
+// without changing the schema file. Optional fields the database lacks are
+// dropped from the schema.
+func detectSchemaTypes(ctx context.Context) {
+	database, err := getNotionDatabase(ctx, notionDatabaseId)
+
+	if err != nil {
+		slog.Warn("Error retrieving database schema, using the configured property types", "err", err)
+		return
+	}
+
+	current := getSchema()
+	detected := Schema{
+		Properties: make(map[string]SchemaProperty, len(current.Properties)),
+		Statuses:   current.Statuses,
+	}
+
+	for field, property := range current.Properties {
+		actual, ok := database.Properties[property.Name]
+
+		if !ok && property.Name != "" && contains(optionalFields, field) {
+			slog.Debug("Skipping optional property missing from the database", "field", field, "property", property.Name)
+
+			property.Name = ""
+		} else if ok && actual.Type != property.Type && contains(propertyTypes[field], actual.Type) {
+			slog.Debug("Detected property type", "field", field, "property", property.Name, "type", actual.Type)
+
+			property.Type = actual.Type
+		}
+
+		detected.Properties[field] = property
+	}
+
+	currentSchema.Store(&detected)
+}
+
+// InitSchema creates a database shaped after the schema under the page
+// parentPageID and returns its ID.
+func InitSchema(ctx context.Context, parentPageID string, title string) (string, error) {
+	loadConfig()
+
+	properties := make(map[string]interface{})
+	types := make(map[string]string)
+	titles := 0
+
+	for _, field := range schemaFields() {
+		property := getSchema().Properties[field]
+
+		if previous, ok := types[property.Name]; ok {
+			if previous != property.Type {
+				return "", fmt.Errorf("property %q is mapped with types %s and %s", property.Name, previous, property.Type)
+			}
+
+			continue
+		}
+
+		if property.Type == "title" {
+			titles++
+		}
+
+		if property.Type == "status" {
+			return "", fmt.Errorf("property %q is a status, which cannot be created through the Notion API; create it as a multi_select and convert it in Notion", property.Name)
+		}
+
+		types[property.Name] = property.Type
+		properties[property.Name] = databaseProperty(field, property.Type)
+	}
+
+	if titles != 1 {
+		return "", fmt.Errorf("the schema must map exactly one field to a title property, found %d", titles)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"parent": Parent{
+			PageID: parentPageID,
+		},
+		"title":      richText(title),
+		"properties": properties,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", notionAPI+"/databases", bytes.NewBuffer(body))
+	req.Header.Add("Authorization", "Bearer "+notionSecret)
+	req.Header.Add("Notion-Version", notionVersion)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := client.Do(req)
+
+	if err != nil || res.StatusCode != 200 {
+		closeResponse(res)
+
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %v", statusCode(res))
+		}
+
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var database NotionDatabase
+
+	if err := json.NewDecoder(res.Body).Decode(&database); err != nil {
+		return "", err
+	}
+
+	return database.ID, nil
+}
+
+func getNotionDatabase(ctx context.Context, databaseID string) (NotionDatabase, error) {
+	client := &http.Client{
+		Timeout:   time.Second * 30,
+		Transport: apiTransport,
+	}
+
+	var database NotionDatabase
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", notionAPI+"/databases/"+databaseID, nil)
+	req.Header.Add("Authorization", "Bearer "+notionSecret)
+	req.Header.Add("Notion-Version", notionVersion)
+	res, err := client.Do(req)
+
+	if err != nil || res.StatusCode != 200 {
+		closeResponse(res)
+
+		if err == nil {
+			err = fmt.Errorf("unexpected status code %v", statusCode(res))
+		}
+
+		return database, err
+	}
+	defer res.Body.Close()
+
+	err = json.NewDecoder(res.Body).Decode(&database)
+
+	return database, err
+}
+
+// schemaFields returns the mapped fields in a stable order.
+func schemaFields() []string {
+	var fields []string
+
+	for field, property := range getSchema().Properties {
+		if property.Name != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+// databaseProperty returns the definition of a new property of the given type.
+// The status property gets an option for every status in the schema, the type
+// one for manga and anime and the release schedule one for every weekday.
+func databaseProperty(field string, propertyType string) interface{} {
+	var options []MultiSelect
+
+	switch field {
+	case fieldStatus:
+		for _, status := range schemaStatuses() {
+			option := getSchema().statusOption(status)
+			options = append(options, MultiSelect{Name: option.Name, Color: option.Color})
+		}
+	case fieldType:
+		options = []MultiSelect{{Name: "Manga"}, {Name: "Anime"}}
+	case fieldReleaseSchedule:
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			options = append(options, MultiSelect{Name: day.String()})
+		}
+	}
+
+	if options != nil && (propertyType == "select" || propertyType == "multi_select") {
+		return map[string]interface{}{
+			propertyType: NotionPropertyOptions{Options: options},
+		}
+	}
+
+	return map[string]interface{}{
+		propertyType: struct{}{},
+	}
+}
+
+func schemaStatuses() []string {
+	var statuses []string
+
+	for status := range getSchema().Statuses {
+		statuses = append(statuses, status)
+	}
+
+	sort.Strings(statuses)
+
+	return statuses
+}
+
+func missingStatusOptions(property NotionDatabaseProperty) []string {
+	options := property.MultiSelect
+	if options == nil {
+		options = property.Select
+	}
+	if options == nil {
+		options = property.Status
+	}
+
+	var existing []string
+	if options != nil {
+		for _, option := range options.Options {
+			existing = append(existing, option.Name)
+		}
+	}
+
+	var missing []string
+
+	for _, status := range schemaStatuses() {
+		if name := getSchema().statusOption(status).Name; !contains(existing, name) {
+			missing = append(missing, name)
+		}
+	}
+
+	return missing
+}
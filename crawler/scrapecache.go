@@ -0,0 +1,258 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScrapeCacheEntry is a scraped page as it was last received.
+type ScrapeCacheEntry struct {
+	URL          string
+	Header       http.Header
+	ETag         string
+	LastModified string
+	FetchedAt    time.Time
+	Body         []byte `json:"-"`
+}
+
+var scrapeCache = map[string]ScrapeCacheEntry{}
+var scrapeCacheMutex sync.Mutex
+
+var scrapeCacheTTL = time.Minute * 30
+var scrapeCacheDir string
+
+// scrapeTransport is used by the scrapers. Pages are served from the cache while
+// they are fresh and revalidated with a conditional request once they are not.
+var scrapeTransport http.RoundTripper = scrapeCacheTransport{next: apiTransport}
+
+// loadScrapeCache reads SCRAPE_CACHE_TTL and SCRAPE_CACHE_DIR. The cache is shared
+// by all profiles, so it is configured from the environment only. A TTL of 0
+// disables the cache. When a directory is set, the raw responses are stored in it
+// and survive restarts.
+func loadScrapeCache() {
+	if ttl := os.Getenv("SCRAPE_CACHE_TTL"); ttl != "" {
+		var err error
+
+		if scrapeCacheTTL, err = time.ParseDuration(ttl); err != nil {
+			slog.Error("Error parsing SCRAPE_CACHE_TTL", "err", err)
+			scrapeCacheTTL = time.Minute * 30
+		}
+	}
+
+	scrapeCacheDir = os.Getenv("SCRAPE_CACHE_DIR")
+
+	if scrapeCacheDir != "" {
+		if err := os.MkdirAll(scrapeCacheDir, 0755); err != nil {
+			slog.Error("Error creating scrape cache directory", "path", scrapeCacheDir, "err", err)
+			scrapeCacheDir = ""
+		}
+	}
+}
+
+// normalizeURL returns the cache key of a page: the URL without its fragment,
+// default port, www. prefix or trailing slash, with the query sorted.
+func normalizeURL(link string) string {
+	u, err := url.Parse(link)
+
+	if err != nil {
+		return link
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	if path == "" {
+		path = "/"
+	}
+
+	key := host + path
+	if query := u.Query().Encode(); query != "" {
+		key += "?" + query
+	}
+
+	return key
+}
+
+type scrapeCacheTransport struct {
+	next http.RoundTripper
+}
+
+func (t scrapeCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || scrapeCacheTTL <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	key := normalizeURL(req.URL.String())
+	entry, ok := getScrapeCacheEntry(key)
+
+	if ok && time.Since(entry.FetchedAt) < scrapeCacheTTL {
+		scrapeCacheResults.WithLabelValues("hit").Inc()
+		return entry.response(req), nil
+	}
+
+	if ok {
+		req = req.Clone(req.Context())
+
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	res, err := t.next.RoundTrip(req)
+
+	if err != nil {
+		return res, err
+	}
+
+	if ok && res.StatusCode == http.StatusNotModified {
+		closeResponse(res)
+		scrapeCacheResults.WithLabelValues("revalidated").Inc()
+
+		entry.FetchedAt = time.Now()
+		setScrapeCacheEntry(key, entry)
+
+		return entry.response(req), nil
+	}
+
+	scrapeCacheResults.WithLabelValues("miss").Inc()
+
+	if res.StatusCode != http.StatusOK {
+		return res, nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	setScrapeCacheEntry(key, ScrapeCacheEntry{
+		URL:          req.URL.String(),
+		Header:       res.Header.Clone(),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+		Body:         body,
+	})
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return res, nil
+}
+
+// response builds the response of a cached page for req.
+func (entry ScrapeCacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+func getScrapeCacheEntry(key string) (ScrapeCacheEntry, bool) {
+	scrapeCacheMutex.Lock()
+	defer scrapeCacheMutex.Unlock()
+
+	if entry, ok := scrapeCache[key]; ok {
+		return entry, true
+	}
+
+	entry, ok := readScrapeCacheEntry(key)
+	if ok {
+		scrapeCache[key] = entry
+	}
+
+	return entry, ok
+}
+
+func setScrapeCacheEntry(key string, entry ScrapeCacheEntry) {
+	scrapeCacheMutex.Lock()
+	defer scrapeCacheMutex.Unlock()
+
+	scrapeCache[key] = entry
+	writeScrapeCacheEntry(key, entry)
+}
+
+// scrapeCachePath returns the path of a cached page in SCRAPE_CACHE_DIR, without
+// extension. The metadata is stored next to the raw body.
+func scrapeCachePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return filepath.Join(scrapeCacheDir, hex.EncodeToString(sum[:]))
+}
+
+func readScrapeCacheEntry(key string) (ScrapeCacheEntry, bool) {
+	var entry ScrapeCacheEntry
+
+	if scrapeCacheDir == "" {
+		return entry, false
+	}
+
+	path := scrapeCachePath(key)
+
+	meta, err := ioutil.ReadFile(path + ".json")
+
+	if err != nil {
+		return entry, false
+	}
+
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		slog.Error("Error parsing scrape cache entry", "path", path+".json", "err", err)
+		return entry, false
+	}
+
+	if entry.Body, err = ioutil.ReadFile(path + ".body"); err != nil {
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// writeScrapeCacheEntry must be called with scrapeCacheMutex held.
+func writeScrapeCacheEntry(key string, entry ScrapeCacheEntry) {
+	if scrapeCacheDir == "" {
+		return
+	}
+
+	path := scrapeCachePath(key)
+
+	meta, err := json.MarshalIndent(entry, "", "  ")
+
+	if err != nil {
+		slog.Error("Error creating scrape cache entry", "url", entry.URL, "err", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path+".body", entry.Body, 0644); err != nil {
+		slog.Error("Error writing scrape cache entry", "url", entry.URL, "err", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(path+".json", meta, 0644); err != nil {
+		slog.Error("Error writing scrape cache entry", "url", entry.URL, "err", err)
+	}
+}
@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Manga tracker</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+.healthy { color: #2e7d32; }
+.failing { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>Manga tracker</h1>
+{{if .Status.Running}}<p>Sync running since {{.Status.StartedAt.Format "2006-01-02 15:04:05"}}</p>{{end}}
+{{if not .Status.FinishedAt.IsZero}}<p>Last sync finished {{.Status.FinishedAt.Format "2006-01-02 15:04:05"}} in {{.Status.Duration}}: {{.Status.PagesCreated}} created, {{.Status.PagesUpdated}} updated, {{.Status.PagesFailed}} failed</p>{{end}}
+<form method="post" action="/sync"><button type="submit">Sync now</button></form>
+<h2>Sources</h2>
+<table>
+<tr><th>Source</th><th>Health</th><th>Successes</th><th>Failures</th><th>Last error</th></tr>
+{{range .Sources}}<tr>
+<td>{{.Name}}</td>
+{{if .Status.Healthy}}<td class="healthy">healthy</td>{{else}}<td class="failing">failing</td>{{end}}
+<td>{{.Status.Successes}}</td>
+<td>{{.Status.Failures}}</td>
+<td>{{.Status.LastError}}</td>
+</tr>{{end}}
+</table>
+</body>
+</html>
+`))
+
+type namedSourceStatus struct {
+	Name   string
+	Status SourceStatus
+}
+
+// Serve runs the HTTP server with the status dashboard, the health check and the
+// endpoints to inspect and trigger syncs.
+func Serve(ctx context.Context, addr string) error {
+	loadConfig()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleDashboard)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+		handleSync(ctx, w, r)
+	})
+	mux.HandleFunc("/series", handleSeries)
+	mux.HandleFunc("/calendar.ics", handleCalendar)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("Listening", "addr", addr)
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	status := getRunStatus()
+
+	var sources []namedSourceStatus
+	for name, source := range status.Sources {
+		sources = append(sources, namedSourceStatus{Name: name, Status: source})
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := statusTemplate.Execute(w, map[string]interface{}{
+		"Status":  status,
+		"Sources": sources,
+	}); err != nil {
+		slog.Error("Error rendering status page", "err", err)
+	}
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, getRunStatus())
+}
+
+// handleSync starts a sync in the background. The sync runs with the server's
+// context rather than the request's, so it outlives the request.
+func handleSync(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !beginSync() {
+		http.Error(w, "sync already running", http.StatusConflict)
+		return
+	}
+
+	go func() {
+		defer endSync()
+
+		runSync(ctx)
+	}()
+
+	// Browsers submitting the dashboard form are sent back to it
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// withRequestProfile runs fn with the profile named by the profile query
+// parameter active, or the first profile when it is missing. Profiles share the
+// package configuration, so while a sync runs the request is refused instead of
+// waiting for it.
+func withRequestProfile(w http.ResponseWriter, r *http.Request, fn func()) {
+	profile, ok := findProfile(r.URL.Query().Get("profile"))
+	if !ok {
+		http.Error(w, "unknown profile", http.StatusNotFound)
+		return
+	}
+
+	if !tryWithProfile(profile, fn) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "sync running, try again later", http.StatusServiceUnavailable)
+	}
+}
+
+func handleSeries(w http.ResponseWriter, r *http.Request) {
+	withRequestProfile(w, r, func() {
+		// Activating the profile reset the schema to the configured types
+		detectSchemaTypes(r.Context())
+
+		mangas, ok := getAllNotionPages(r.Context())
+		if !ok {
+			http.Error(w, errNotionQuery.Error(), http.StatusBadGateway)
+			return
+		}
+
+		writeJSON(w, mangas)
+	})
+}
+
+func handleCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	withRequestProfile(w, r, func() {
+		detectSchemaTypes(ctx)
+
+		mangas, ok := getAllNotionPages(ctx)
+		if !ok {
+			http.Error(w, errNotionQuery.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+
+		if err := writeCalendar(w, calendarEvents(mangas)); err != nil {
+			slog.Error("Error writing calendar", "err", err)
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding response", "err", err)
+	}
+}
@@ -0,0 +1,233 @@
+package crawler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// PageState holds the values the tracker last wrote to a Notion page. A field
+// whose current Notion value differs from the recorded one has been edited by
+// hand and is left alone.
+type PageState struct {
+	Title             string `json:"title,omitempty"`
+	Cover             string `json:"cover,omitempty"`
+	Icon              string `json:"icon,omitempty"`
+	PublicationStatus string `json:"publicationStatus,omitempty"`
+	MangaUpdatesID    int64  `json:"mangaUpdatesId,omitempty"`
+	AniListID         int    `json:"aniListId,omitempty"`
+}
+
+// Release records a latest release bump written to a Notion page.
+type Release struct {
+	Title           string    `json:"title"`
+	Link            string    `json:"link"`
+	Chapter         float32   `json:"chapter"`
+	PreviousChapter float32   `json:"previousChapter"`
+	At              time.Time `json:"at"`
+}
+
+// ScrapeFailure records a series link the crawler couldn't read a chapter from.
+// A link that keeps failing has a single entry, with the time it first and last
+// failed and how often it did.
+type ScrapeFailure struct {
+	Link    string    `json:"link"`
+	Source  string    `json:"source"`
+	Reason  string    `json:"reason"`
+	At      time.Time `json:"at"`
+	FirstAt time.Time `json:"firstAt,omitempty"`
+	Count   int       `json:"count,omitempty"`
+}
+
+type SyncState struct {
+	Pages    map[string]PageState `json:"pages"`
+	Releases map[string][]Release `json:"releases,omitempty"`
+	Failures []ScrapeFailure      `json:"failures,omitempty"`
+	// Airings are the upcoming episodes of anime pages as of the last sync, so
+	// the calendar doesn't have to ask the anime sources again
+	Airings map[string][]Airing `json:"airings,omitempty"`
+}
+
+// historyRetention is how long releases and scrape failures are kept around for
+// digests.
+const historyRetention = time.Hour * 24 * 90
+
+var state SyncState
+var stateMutex sync.Mutex
+
+func stateFile() string {
+	if file := getenv("SYNC_STATE_FILE"); file != "" {
+		return file
+	}
+
+	if name := profileName(); name != "" {
+		return "sync-state-" + name + ".json"
+	}
+
+	return "sync-state.json"
+}
+
+func loadState() {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	state = SyncState{
+		Pages:    make(map[string]PageState),
+		Releases: make(map[string][]Release),
+	}
+
+	body, err := ioutil.ReadFile(stateFile())
+
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("Error reading sync state", "err", err)
+		}
+
+		return
+	}
+
+	if err := json.Unmarshal(body, &state); err != nil {
+		slog.Error("Error parsing sync state", "err", err)
+	}
+
+	if state.Pages == nil {
+		state.Pages = make(map[string]PageState)
+	}
+
+	if state.Releases == nil {
+		state.Releases = make(map[string][]Release)
+	}
+}
+
+// saveState must be called with stateMutex held.
+func saveState() {
+	body, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		slog.Error("Error creating body for sync state", "err", err)
+		return
+	}
+
+	if err := ioutil.WriteFile(stateFile(), body, 0644); err != nil {
+		slog.Error("Error writing sync state", "err", err)
+	}
+}
+
+func getPageState(pageID string) PageState {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	return state.Pages[pageID]
+}
+
+func setPageState(pageID string, pageState PageState) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	state.Pages[pageID] = pageState
+	saveState()
+}
+
+func recordRelease(pageID string, release Release) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if state.Releases == nil {
+		state.Releases = make(map[string][]Release)
+	}
+
+	var releases []Release
+	for _, r := range state.Releases[pageID] {
+		if time.Since(r.At) < historyRetention {
+			releases = append(releases, r)
+		}
+	}
+
+	state.Releases[pageID] = append(releases, release)
+	saveState()
+}
+
+func recordAirings(pageID string, upcoming []Airing) {
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	if len(upcoming) == 0 {
+		if _, ok := state.Airings[pageID]; !ok {
+			return
+		}
+
+		delete(state.Airings, pageID)
+	} else {
+		if state.Airings == nil {
+			state.Airings = make(map[string][]Airing)
+		}
+
+		state.Airings[pageID] = upcoming
+	}
+
+	saveState()
+}
+
+func recordScrapeFailure(failure ScrapeFailure) {
+	recordSourceFailure(failure.Source, failure.Reason)
+
+	stateMutex.Lock()
+	defer stateMutex.Unlock()
+
+	failure.FirstAt = failure.At
+	failure.Count = 1
+
+	var failures []ScrapeFailure
+	for _, f := range append(state.Failures, failure) {
+		if time.Since(f.At) >= historyRetention {
+			continue
+		}
+
+		if f.FirstAt.IsZero() {
+			f.FirstAt = f.At
+		}
+		if f.Count == 0 {
+			f.Count = 1
+		}
+
+		merged := false
+		for i, existing := range failures {
+			if existing.Source == f.Source && existing.Link == f.Link {
+				failures[i] = mergeScrapeFailures(existing, f)
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			failures = append(failures, f)
+		}
+	}
+
+	state.Failures = failures
+	saveState()
+}
+
+// mergeScrapeFailures combines two failures of the same link, keeping the reason
+// of the latest one.
+func mergeScrapeFailures(a ScrapeFailure, b ScrapeFailure) ScrapeFailure {
+	if b.At.Before(a.At) {
+		a, b = b, a
+	}
+
+	b.Count += a.Count
+	if a.FirstAt.Before(b.FirstAt) {
+		b.FirstAt = a.FirstAt
+	}
+
+	return b
+}
+
+// canOverwrite reports whether a field may be replaced: it is either still
+// empty or holds exactly what the tracker wrote to it last time.
+func canOverwrite(current string, lastWritten string) bool {
+	return current == "" || current == lastWritten
+}
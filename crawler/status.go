@@ -0,0 +1,196 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SourceStatus holds the scrape results of a single source. The counters cover
+// the last run, the timestamps every run since the process started.
+type SourceStatus struct {
+	Successes   int       `json:"successes"`
+	Failures    int       `json:"failures"`
+	LastSuccess time.Time `json:"lastSuccess"`
+	LastFailure time.Time `json:"lastFailure"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// Healthy reports whether the source worked the last time it was used.
+func (s SourceStatus) Healthy() bool {
+	return !s.LastSuccess.Before(s.LastFailure)
+}
+
+// RunStatus describes the current or last sync run.
+type RunStatus struct {
+	RunID        string                  `json:"runId"`
+	Running      bool                    `json:"running"`
+	StartedAt    time.Time               `json:"startedAt"`
+	FinishedAt   time.Time               `json:"finishedAt"`
+	Duration     string                  `json:"duration"`
+	PagesCreated int                     `json:"pagesCreated"`
+	PagesUpdated int                     `json:"pagesUpdated"`
+	PagesFailed  int                     `json:"pagesFailed"`
+	Sources      map[string]SourceStatus `json:"sources"`
+}
+
+var runStatus = RunStatus{
+	Sources: make(map[string]SourceStatus),
+}
+var runStatusMutex sync.Mutex
+
+var syncRunning bool
+var shuttingDown bool
+var syncRunningMutex sync.Mutex
+var runningSyncs sync.WaitGroup
+
+// beginSync marks a sync as running. It returns false when one already is, so
+// runs started by the schedule and by hand never overlap, or when shutting down.
+func beginSync() bool {
+	syncRunningMutex.Lock()
+	defer syncRunningMutex.Unlock()
+
+	if syncRunning || shuttingDown {
+		return false
+	}
+
+	syncRunning = true
+	runningSyncs.Add(1)
+
+	return true
+}
+
+func endSync() {
+	syncRunningMutex.Lock()
+	defer syncRunningMutex.Unlock()
+
+	syncRunning = false
+	runningSyncs.Done()
+}
+
+// sleep waits for d, returning false early when ctx is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Shutdown prevents new syncs from starting and waits until the running sync and
+// its in-flight Notion writes have finished, or until ctx is done. The running
+// sync stops starting new work once the context it was given is cancelled.
+func Shutdown(ctx context.Context) error {
+	syncRunningMutex.Lock()
+	shuttingDown = true
+	syncRunningMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		runningSyncs.Wait()
+		pendingWrites.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func beginRun() {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	runStatus.RunID = newRunID()
+	runStatus.Running = true
+	setRunID(runStatus.RunID)
+	runStatus.StartedAt = time.Now()
+	runStatus.PagesCreated = 0
+	runStatus.PagesUpdated = 0
+	runStatus.PagesFailed = 0
+
+	for name, source := range runStatus.Sources {
+		source.Successes = 0
+		source.Failures = 0
+		runStatus.Sources[name] = source
+	}
+}
+
+func endRun() time.Duration {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	runStatus.Running = false
+	runStatus.FinishedAt = time.Now()
+	duration := runStatus.FinishedAt.Sub(runStatus.StartedAt)
+	runStatus.Duration = duration.String()
+
+	observeRun(duration, runStatus.PagesFailed)
+
+	return duration
+}
+
+// getRunStatus returns a copy of the run status that is safe to read.
+func getRunStatus() RunStatus {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	status := runStatus
+	status.Sources = make(map[string]SourceStatus, len(runStatus.Sources))
+
+	for name, source := range runStatus.Sources {
+		status.Sources[name] = source
+	}
+
+	return status
+}
+
+func recordSourceSuccess(name string) {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	sourceScrapes.WithLabelValues(name, "success").Inc()
+
+	source := runStatus.Sources[name]
+	source.Successes++
+	source.LastSuccess = time.Now()
+	runStatus.Sources[name] = source
+}
+
+func recordSourceFailure(name string, reason string) {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	sourceScrapes.WithLabelValues(name, "failure").Inc()
+
+	source := runStatus.Sources[name]
+	source.Failures++
+	source.LastFailure = time.Now()
+	source.LastError = reason
+	runStatus.Sources[name] = source
+}
+
+// recordPageWrite counts a page created or updated in Notion, or a failed write.
+func recordPageWrite(created bool, ok bool) {
+	runStatusMutex.Lock()
+	defer runStatusMutex.Unlock()
+
+	switch {
+	case !ok:
+		runStatus.PagesFailed++
+		pageWrites.WithLabelValues("failed").Inc()
+	case created:
+		runStatus.PagesCreated++
+		pageWrites.WithLabelValues("created").Inc()
+	default:
+		runStatus.PagesUpdated++
+		pageWrites.WithLabelValues("updated").Inc()
+	}
+}
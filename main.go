@@ -1,16 +1,120 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/florisboom/go-notion-manga-tracker/crawler"
-	"github.com/robfig/cron"
+	"github.com/robfig/cron/v3"
 )
 
 func main() {
-	c := cron.New()
+	crawler.SetupLogging()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 && os.Args[1] == "mal-login" {
+		crawler.LoginMyAnimeList(ctx)
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "calendar" {
+		if err := crawler.WriteCalendar(ctx, os.Stdout); err != nil {
+			slog.Error("Error writing calendar", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		runSchemaCommand(ctx, os.Args[2:])
+		return
+	}
+
+	// Skip a scheduled run while the previous one is still going
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
 	c.AddFunc("@hourly", func() {
-		crawler.Sync()
+		crawler.Sync(ctx)
 	})
 
+	switch os.Getenv("DIGEST") {
+	case "daily":
+		c.AddFunc("@daily", func() {
+			crawler.SendDigest(ctx, time.Hour*24)
+		})
+	case "weekly":
+		c.AddFunc("@weekly", func() {
+			crawler.SendDigest(ctx, time.Hour*24*7)
+		})
+	}
+
+	if addr := os.Getenv("HTTP_ADDR"); addr != "" {
+		go func() {
+			if err := crawler.Serve(ctx, addr); err != nil {
+				slog.Error("Error running http server", "err", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	c.Start()
-	select {}
+
+	<-ctx.Done()
+
+	slog.Info("Shutting down, waiting for the running sync to finish")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	defer cancel()
+
+	jobsDone := c.Stop()
+
+	if err := crawler.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down", "err", err)
+		os.Exit(1)
+	}
+
+	select {
+	case <-jobsDone.Done():
+	case <-shutdownCtx.Done():
+		slog.Error("Error shutting down", "err", shutdownCtx.Err())
+		os.Exit(1)
+	}
+}
+
+// runSchemaCommand checks the configured database against the schema, or creates
+// a new database shaped after it.
+func runSchemaCommand(ctx context.Context, args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "check":
+		ok, err := crawler.CheckSchema(ctx, os.Stdout)
+		if err != nil {
+			slog.Error("Error checking database schema", "err", err)
+			os.Exit(1)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	case len(args) >= 2 && args[0] == "init":
+		title := "Manga"
+		if len(args) > 2 {
+			title = args[2]
+		}
+
+		databaseID, err := crawler.InitSchema(ctx, args[1], title)
+		if err != nil {
+			slog.Error("Error creating database", "err", err)
+			os.Exit(1)
+		}
+
+		fmt.Println(databaseID)
+	default:
+		fmt.Fprintln(os.Stderr, "usage: schema check | schema init <parent page id> [title]")
+		os.Exit(2)
+	}
 }